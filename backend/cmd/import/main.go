@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/backend"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/logging"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/tgexport"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/pkg/config"
+)
+
+// main backfills the library from a Telegram Desktop channel export:
+// 1. Load configuration from environment variables
+// 2. Read the exported "result.json" file
+// 3. Convert every exported post into a bot message
+// 4. Process and save each message, the same way live posts are handled
+//
+// Saving is idempotent, so the import can safely be repeated.
+func main() {
+	file := flag.String("file", "result.json", "path to the Telegram Desktop JSON export")
+	chatID := flag.Int64("chat-id", 0, "Bot API chat ID to store posts under (defaults to the exported channel ID)")
+	library := flag.String("library", "", "library to assign posts to (defaults to the library configured for the chat)")
+	flag.Parse()
+
+	// Load application configuration from environment variables
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("Failed to load configuration", err)
+	}
+
+	if err := logging.Setup(os.Stdout, cfg.LogLevel); err != nil {
+		fatal("Failed to set up logging", err)
+	}
+
+	// Read the channel export
+	export, err := tgexport.Load(*file)
+	if err != nil {
+		fatal("Failed to load export", err)
+	}
+
+	if *chatID == 0 {
+		*chatID = export.ChatID()
+	}
+	if *library == "" {
+		configured, ok := cfg.Library(*chatID)
+		if !ok {
+			slog.Error("Chat is not a configured channel, pass -library to import it anyway", "chat_id", *chatID)
+			os.Exit(1)
+		}
+		*library = configured
+	}
+
+	// Open the post store without starting the writer;
+	// messages are processed and saved synchronously instead of being queued
+	backend, err := backend.Open(cfg)
+	if err != nil {
+		fatal("Failed to open storage", err)
+	}
+	defer backend.Close()
+
+	var imported, skipped, failed int
+	for _, post := range export.Posts(*chatID) {
+		msg := bot.NewMessage(post, *library, false)
+		if msg.Text == "" {
+			skipped++
+			continue
+		}
+
+		ctx := logging.WithCorrelationID(context.Background(), msg.CorrelationID)
+		processed, err := processor.Process(msg)
+		if err != nil {
+			slog.WarnContext(ctx, "Skipping message due to processing error", "message_id", msg.MessageID, "error", err)
+			skipped++
+			continue
+		}
+
+		if err := backend.Store.SaveMessage(ctx, *processed); err != nil {
+			slog.ErrorContext(ctx, "Failed to save message", "message_id", msg.MessageID, "error", err)
+			failed++
+			continue
+		}
+
+		imported++
+	}
+
+	slog.Info("Import finished", "imported", imported, "skipped", skipped, "failed", failed)
+}
+
+// fatal logs a failure and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
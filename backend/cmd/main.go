@@ -2,63 +2,198 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/api"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/backend"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/blob"
 	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
-	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/db"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/logging"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/metrics"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/mirror"
 	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/queue"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/search"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/supervisor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/tracing"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/writer"
 	"github.com/kirinyoku/kirinyoku-space-web/backend/pkg/config"
 )
 
+// queueCapacity is the number of unfinished messages each queue holds before
+// the stage writing to it has to wait.
+const queueCapacity = 1000
+
+// shutdownTimeout bounds the time spent draining the pipeline and finishing
+// HTTP requests after a shutdown signal. Messages left unfinished stay in the
+// queues and are handled after the next start.
+const shutdownTimeout = 30 * time.Second
+
+// maxPollAge is how long ago the last successful getUpdates request may
+// have been for the bot to count as ready; long polls last up to a minute.
+const maxPollAge = 3 * time.Minute
+
 // main initializes and starts all application components in the following order:
-// 1. Load configuration from environment variables
-// 2. Create communication channels between components
-// 3. Initialize and start the Telegram bot
-// 4. Initialize and start the message processor
-// 5. Initialize and start the MongoDB connection
-// 6. Start the HTTP API server
-// 7. Wait for shutdown signal
+// 1. Load configuration from environment variables and set up structured logging and tracing
+// 2. Open the durable queues between components, replaying unfinished messages
+// 3. Initialize and start the Telegram bot (long polling or webhook); every
+// stage runs under a supervisor that restarts it after failures
+// 4. Initialize and start the message processor, reporting rejected posts if configured
+// 5. Open the post store (MongoDB, SQLite, Postgres or in-memory), load the search
+// index from it and start the writer saving processed messages to both,
+// mirroring attachments if configured
+// 6. Record messages that fail processing or persistence as dead letters in the post store
+// 7. Start the HTTP API server with search, health, readiness and metrics endpoints,
+// exposing dead letters to admins if configured
+// 8. Wait for shutdown signal
+// 9. Shut down in pipeline order: stop receiving updates, drain the processor
+// and the database writer, stop the HTTP API server, flush pending traces,
+// then close the post store
 func main() {
 	// Load application configuration from environment variables
 	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("Failed to load configuration", err)
+	}
+
+	// Log JSON records at the configured level
+	if err := logging.Setup(os.Stdout, cfg.LogLevel); err != nil {
+		fatal("Failed to set up logging", err)
+	}
+
+	// Export traces if an OTLP endpoint is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.OTLPEndpoint)
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
+
+	// Open durable queues for inter-component communication
+	botQueue, err := queue.Open[bot.Message](filepath.Join(cfg.QueueDir, "messages.log"), queueCapacity) // Raw messages from Telegram
+	if err != nil {
+		fatal("Failed to open message queue", err)
 	}
+	defer botQueue.Close()
 
-	// Create buffered channels for inter-component communication
-	botChan := make(chan bot.Message, 100)                 // Channel for raw messages from Telegram
-	procChan := make(chan processor.ProcessedMessage, 100) // Channel for processed messages
+	procQueue, err := queue.Open[processor.ProcessedMessage](filepath.Join(cfg.QueueDir, "processed.log"), queueCapacity) // Processed messages
+	if err != nil {
+		fatal("Failed to open processed message queue", err)
+	}
+	defer procQueue.Close()
+	metrics.RegisterQueue("messages", botQueue.Len, botQueue.Capacity)
+	metrics.RegisterQueue("processed", procQueue.Len, procQueue.Capacity)
+
+	// Track the health of the pipeline stages
+	supervisor := supervisor.New()
 
 	// Initialize and start Telegram bot
-	bot, err := bot.New(cfg.TelegramToken, cfg.TelegramChatID, botChan)
+	bot, err := bot.New(cfg.TelegramToken, cfg.TelegramAPIURL, cfg.TelegramChannels, botQueue)
+	if err != nil {
+		fatal("Failed to create bot", err)
+	}
+	if cfg.UseWebhook() {
+		err = bot.StartWebhook(cfg.TelegramWebhookURL, cfg.TelegramWebhookSecret, supervisor.Add("bot"))
+	} else {
+		err = bot.Start(supervisor.Add("bot"))
+	}
 	if err != nil {
-		log.Fatalf("Failed to create bot: %v", err)
+		fatal("Failed to start bot", err)
 	}
-	bot.Start()
 
 	// Initialize and start message processor
-	processor, err := processor.NewProcessor(botChan, procChan)
+	processor, err := processor.NewProcessor(botQueue, procQueue)
 	if err != nil {
-		log.Fatalf("Failed to create processor: %v", err)
+		fatal("Failed to create processor", err)
+	}
+	notifier := bot.Notifier(cfg.TelegramAdminChatID)
+	if cfg.TelegramAdminChatID != 0 {
+		processor.SetReporter(notifier)
 	}
-	processor.Start()
 
-	// Initialize and start MongoDB connection
-	db, err := db.New(cfg.MongoURI, cfg.MongoDatabase, cfg.MongoCollection, procChan)
+	// Open the post store selected by the storage DSN
+	backend, err := backend.Open(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create database: %v", err)
+		fatal("Failed to open storage", err)
+	}
+	defer backend.Close()
+
+	// Initialize the writer saving processed messages to the post store
+	writer, err := writer.New(backend.Store, procQueue)
+	if err != nil {
+		fatal("Failed to create writer", err)
+	}
+
+	// Index the stored posts for search; the writer adds posts as they are saved
+	index := search.NewIndex()
+	if err := index.Load(context.Background(), backend.Store); err != nil {
+		fatal("Failed to load search index", err)
 	}
-	defer db.Disconnect()
-	db.Start()
+	slog.Info("Search index loaded", "posts", index.Len())
+	writer.SetIndex(index)
+
+	// Record failed messages so they can be inspected and retried
+	processor.SetDeadLetters(backend.DeadLetters)
+	writer.SetDeadLetters(backend.DeadLetters)
+	processor.Start(supervisor.Add("processor"))
+
+	// Initialize attachment mirroring into local blob storage, if configured
+	var files blob.Store
+	if cfg.BlobDir != "" {
+		store, err := blob.NewFileStore(cfg.BlobDir)
+		if err != nil {
+			fatal("Failed to create blob store", err)
+		}
+		files = store
+
+		mirror, err := mirror.New(bot, files)
+		if err != nil {
+			fatal("Failed to create mirror", err)
+		}
+		writer.SetMirror(mirror)
+	}
+	writer.Start(supervisor.Add("writer"))
 
 	// Initialize and start HTTP API server
-	server := api.NewServer(db)
+	server := api.NewServer(backend.Store)
+	server.EnableHealth(supervisor)
+	server.EnableSearch(index)
+	server.AddReadinessCheck("storage", func(ctx context.Context) (any, error) {
+		return nil, backend.Store.Ping(ctx)
+	})
+	if !cfg.UseWebhook() {
+		server.AddReadinessCheck("telegram", func(ctx context.Context) (any, error) {
+			lastPoll := bot.LastPoll()
+			details := map[string]any{"last_poll": lastPoll}
+			if time.Since(lastPoll) > maxPollAge {
+				return details, fmt.Errorf("no successful getUpdates request in the last %s", maxPollAge)
+			}
+			return details, nil
+		})
+	}
+	server.AddReadinessCheck("queues", func(ctx context.Context) (any, error) {
+		return map[string]any{
+			"messages":  map[string]any{"depth": botQueue.Len(), "capacity": botQueue.Capacity()},
+			"processed": map[string]any{"depth": procQueue.Len(), "capacity": procQueue.Capacity()},
+		}, nil
+	})
+	if files != nil {
+		server.EnableFileDownloads(files)
+	}
+	if cfg.APIAdminToken != "" {
+		// Retried messages re-enter the pipeline as if they had just been received
+		server.EnableDeadLetters(backend.DeadLetters, bot.Enqueue, cfg.APIAdminToken)
+	}
+	if cfg.UseWebhook() {
+		server.RegisterWebhook(cfg.WebhookPath(), bot.WebhookHandler(cfg.TelegramWebhookSecret))
+	}
 	go func() {
 		if err := server.Start(cfg.APIPort); err != nil {
-			log.Fatalf("Failed to start API server: %v", err)
+			fatal("Failed to start API server", err)
 		}
 	}()
 
@@ -68,5 +203,38 @@ func main() {
 
 	// Wait for shutdown signal
 	<-ctx.Done()
-	log.Println("Shutting down gracefully...")
+	stop()
+	slog.Info("Shutting down gracefully")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Stop accepting updates, then let each stage drain what the previous one queued
+	if err := bot.Stop(shutdownCtx); err != nil {
+		slog.Error("Failed to stop bot", "error", err)
+	}
+	if err := processor.Stop(shutdownCtx); err != nil {
+		slog.Error("Failed to drain processor", "error", err)
+	}
+	if err := notifier.Stop(shutdownCtx); err != nil {
+		slog.Error("Failed to send pending reports", "error", err)
+	}
+	if err := writer.Stop(shutdownCtx); err != nil {
+		slog.Error("Failed to drain database writer", "error", err)
+	}
+	if err := server.Stop(shutdownCtx); err != nil {
+		slog.Error("Failed to stop API server", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+
+	// The post store and the queues are closed by the deferred calls
+	slog.Info("Shutdown complete")
+}
+
+// fatal logs a startup failure and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
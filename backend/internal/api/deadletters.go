@@ -0,0 +1,99 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+)
+
+// retryRequest holds optional corrections applied to a message before it is retried
+type retryRequest struct {
+	Text *string `json:"text"` // Replacement message text
+	URL  *string `json:"url"`  // Replacement primary URL
+}
+
+// handleListDeadLetters handles HTTP GET requests for listing dead-lettered messages
+func (s *Server) handleListDeadLetters(ctx *gin.Context) {
+	page, limit := getPaginationParams(ctx)
+
+	response, err := s.deadLetters.List(ctx.Request.Context(), page, limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"entries":     response.Entries,
+		"total_count": response.TotalCount,
+	})
+}
+
+// handleGetDeadLetter handles HTTP GET requests for inspecting a single dead-lettered message
+func (s *Server) handleGetDeadLetter(ctx *gin.Context) {
+	entry, err := s.deadLetters.Get(ctx.Request.Context(), ctx.Param("id"))
+	if errors.Is(err, deadletter.ErrNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, entry)
+}
+
+// handleRetryDeadLetter handles HTTP POST requests for re-submitting a dead-lettered message.
+// The request body may correct the message text and URL before the retry.
+// The entry is kept until the message is saved, so a failed retry increments its attempt count.
+func (s *Server) handleRetryDeadLetter(ctx *gin.Context) {
+	var req retryRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	entry, err := s.deadLetters.Get(ctx.Request.Context(), ctx.Param("id"))
+	if errors.Is(err, deadletter.ErrNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	msg := entry.Message
+	if req.Text != nil {
+		msg.Text = *req.Text
+	}
+	if req.URL != nil {
+		msg.URL = *req.URL
+	}
+
+	if err := s.retry(ctx.Request.Context(), msg); err != nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{"id": entry.ID, "message": msg})
+}
+
+// handleDeleteDeadLetter handles HTTP DELETE requests for discarding a dead-lettered message
+func (s *Server) handleDeleteDeadLetter(ctx *gin.Context) {
+	err := s.deadLetters.Delete(ctx.Request.Context(), ctx.Param("id"))
+	if errors.Is(err, deadletter.ErrNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
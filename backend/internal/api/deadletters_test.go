@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage/memory"
+)
+
+// adminHeader authorizes requests to the dead-letter endpoints of test servers.
+var adminHeader = http.Header{"Authorization": {"Bearer secret"}}
+
+// newDeadLetterServer returns a server exposing a memory dead-letter store
+// holding the failed message 100:1, and the messages passed to its retry
+// function. Retries fail with retryErr if it is set.
+func newDeadLetterServer(t *testing.T, retryErr error) (*Server, *[]bot.Message) {
+	t.Helper()
+	deadLetters := memory.NewDeadLetters()
+	msg := bot.Message{ChatID: 100, MessageID: 1, Text: "Name: Learning Go", URL: "https://example.com/old"}
+	if err := deadLetters.Record(context.Background(), msg, deadletter.StageProcess, errors.New("missing type")); err != nil {
+		t.Fatal(err)
+	}
+
+	var retried []bot.Message
+	s, _ := newTestServer(t)
+	s.EnableDeadLetters(deadLetters, func(ctx context.Context, msg bot.Message) error {
+		if retryErr != nil {
+			return retryErr
+		}
+		retried = append(retried, msg)
+		return nil
+	}, "secret")
+	return s, &retried
+}
+
+func TestDeadLettersRequireAdminToken(t *testing.T) {
+	s, _ := newDeadLetterServer(t, nil)
+
+	for _, header := range []http.Header{nil, {"Authorization": {"Bearer wrong"}}, {"Authorization": {"secret"}}} {
+		if rec := serve(s, http.MethodGet, "/dead-letters", header); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status = %d, want %d", header.Get("Authorization"), rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestHandleListAndGetDeadLetters(t *testing.T) {
+	s, _ := newDeadLetterServer(t, nil)
+
+	rec := serve(s, http.MethodGet, "/dead-letters", adminHeader)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list: status = %d: %s", rec.Code, rec.Body)
+	}
+	var list struct {
+		Entries    []deadletter.Entry `json:"entries"`
+		TotalCount int64              `json:"total_count"`
+	}
+	decode(t, rec, &list)
+	if list.TotalCount != 1 || len(list.Entries) != 1 || list.Entries[0].ID != "100:1" {
+		t.Errorf("list = %+v, want entry 100:1", list)
+	}
+
+	rec = serve(s, http.MethodGet, "/dead-letters/100:1", adminHeader)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get: status = %d: %s", rec.Code, rec.Body)
+	}
+	var entry deadletter.Entry
+	decode(t, rec, &entry)
+	if entry.Stage != deadletter.StageProcess || entry.Error != "missing type" || entry.Attempts != 1 {
+		t.Errorf("entry = %+v", entry)
+	}
+
+	if rec := serve(s, http.MethodGet, "/dead-letters/100:2", adminHeader); rec.Code != http.StatusNotFound {
+		t.Errorf("get of a missing entry: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandleRetryDeadLetter(t *testing.T) {
+	s, retried := newDeadLetterServer(t, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/dead-letters/100:1/retry", strings.NewReader(`{"text": "Name: Learning Go\nType: book"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body)
+	}
+	if len(*retried) != 1 {
+		t.Fatalf("retried %d messages, want 1", len(*retried))
+	}
+	if msg := (*retried)[0]; msg.Text != "Name: Learning Go\nType: book" || msg.URL != "https://example.com/old" {
+		t.Errorf("retried message = %+v, want the corrected text and the stored URL", msg)
+	}
+
+	// The entry is kept until the retried message is saved
+	if rec := serve(s, http.MethodGet, "/dead-letters/100:1", adminHeader); rec.Code != http.StatusOK {
+		t.Errorf("get after retry: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if rec := serve(s, http.MethodPost, "/dead-letters/100:2/retry", adminHeader); rec.Code != http.StatusNotFound {
+		t.Errorf("retry of a missing entry: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandleRetryDeadLetterFailure(t *testing.T) {
+	s, _ := newDeadLetterServer(t, errors.New("queue full"))
+
+	if rec := serve(s, http.MethodPost, "/dead-letters/100:1/retry", adminHeader); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHandleDeleteDeadLetter(t *testing.T) {
+	s, _ := newDeadLetterServer(t, nil)
+
+	if rec := serve(s, http.MethodDelete, "/dead-letters/100:1", adminHeader); rec.Code != http.StatusNoContent {
+		t.Errorf("delete: status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if rec := serve(s, http.MethodDelete, "/dead-letters/100:1", adminHeader); rec.Code != http.StatusNotFound {
+		t.Errorf("second delete: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
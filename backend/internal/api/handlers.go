@@ -1,13 +1,21 @@
 package api
 
 import (
+	"errors"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/blob"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/metrics"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage"
 )
 
-// handleGetPosts handles HTTP GET requests for retrieving filtered posts
+// handleGetPosts handles HTTP GET requests for retrieving filtered posts.
+// With facets=true, the response also counts the types, tags and languages
+// of all posts matching the filters.
 func (s *Server) handleGetPosts(ctx *gin.Context) {
 	page, limit := getPaginationParams(ctx)
 
@@ -15,22 +23,47 @@ func (s *Server) handleGetPosts(ctx *gin.Context) {
 	tag := ctx.Query("tag")
 	postType := ctx.Query("type")
 	language := ctx.Query("language")
+	library := ctx.Query("library")
+	countFilters(ctx, "search", "tag", "type", "language", "library")
 
-	response, err := s.db.GetPostsWithFilters(query, tag, postType, language, page, limit)
+	getPosts := s.db.GetPostsWithFilters
+	if facets, _ := strconv.ParseBool(ctx.Query("facets")); facets {
+		getPosts = s.db.GetPostsWithFacets
+	}
+	response, err := getPosts(ctx.Request.Context(), query, tag, postType, language, library, page, limit)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
+	body := gin.H{
 		"posts":       response.Posts,
 		"total_count": response.TotalCount,
-	})
+	}
+	if response.Facets != nil {
+		body["facets"] = response.Facets
+	}
+	ctx.JSON(http.StatusOK, body)
 }
 
-// handleGetTags handles HTTP GET requests for retrieving all unique tags
+// handleSearch handles HTTP GET requests for searching posts with the search
+// index, returning scored hits with highlighted snippets, optionally limited
+// to one library
+func (s *Server) handleSearch(ctx *gin.Context) {
+	page, limit := getPaginationParams(ctx)
+
+	query := ctx.Query("q")
+	if strings.TrimSpace(query) == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "query parameter q is required"})
+		return
+	}
+	ctx.JSON(http.StatusOK, s.index.Search(ctx.Request.Context(), query, ctx.Query("library"), page, limit))
+}
+
+// handleGetTags handles HTTP GET requests for retrieving all unique tags,
+// optionally limited to one library
 func (s *Server) handleGetTags(ctx *gin.Context) {
-	tags, err := s.db.GetTags()
+	tags, err := s.db.GetTags(ctx.Request.Context(), ctx.Query("library"))
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -38,9 +71,10 @@ func (s *Server) handleGetTags(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, tags)
 }
 
-// handleGetLanguages handles HTTP GET requests for retrieving all unique languages
+// handleGetLanguages handles HTTP GET requests for retrieving all unique languages,
+// optionally limited to one library
 func (s *Server) handleGetLanguages(ctx *gin.Context) {
-	languages, err := s.db.GetLanguages()
+	languages, err := s.db.GetLanguages(ctx.Request.Context(), ctx.Query("library"))
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -48,6 +82,71 @@ func (s *Server) handleGetLanguages(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, languages)
 }
 
+// handleGetLibraries handles HTTP GET requests for retrieving all libraries that have posts
+func (s *Server) handleGetLibraries(ctx *gin.Context) {
+	libraries, err := s.db.GetLibraries(ctx.Request.Context())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, libraries)
+}
+
+// handleGetPostFile handles HTTP GET requests for downloading the mirrored attachment of a post.
+// Range requests are supported, so large files can be resumed and media can be streamed.
+func (s *Server) handleGetPostFile(ctx *gin.Context) {
+	chatID, err := strconv.ParseInt(ctx.Param("chat_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat_id"})
+		return
+	}
+
+	messageID, err := strconv.Atoi(ctx.Param("message_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid message_id"})
+		return
+	}
+
+	post, err := s.db.GetPost(ctx.Request.Context(), chatID, messageID)
+	if errors.Is(err, storage.ErrNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	attachment := post.Attachment
+	if attachment == nil || attachment.BlobKey == "" {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "post has no downloadable file"})
+		return
+	}
+
+	object, err := s.files.Open(ctx.Request.Context(), attachment.BlobKey)
+	if errors.Is(err, blob.ErrNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer object.Close()
+
+	contentType := attachment.MIMEType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	ctx.Header("Content-Type", contentType)
+
+	if attachment.FileName != "" {
+		ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}))
+	}
+
+	http.ServeContent(ctx.Writer, ctx.Request, attachment.FileName, object.ModTime, object)
+}
+
 // getPaginationParams extracts and validates pagination parameters from request
 // Returns page number and limit with default values if not provided or invalid
 func getPaginationParams(c *gin.Context) (int, int) {
@@ -67,3 +166,12 @@ func getPaginationParams(c *gin.Context) (int, int) {
 
 	return page, limit
 }
+
+// countFilters records which of the given query parameters a request uses
+func countFilters(ctx *gin.Context, filters ...string) {
+	for _, filter := range filters {
+		if ctx.Query(filter) != "" {
+			metrics.PostFilters.WithLabelValues(filter).Inc()
+		}
+	}
+}
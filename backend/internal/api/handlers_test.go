@@ -0,0 +1,284 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/blob"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/search"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage/memory"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// testPosts are saved by newTestServer, from the oldest to the newest.
+var testPosts = []processor.ProcessedMessage{
+	{MessageID: 1, Library: "books", Name: "Learning Go", Type: "book", Tags: []string{"#go", "en"}},
+	{MessageID: 2, Library: "books", Name: "Программирование на C++", Type: "book", Tags: []string{"cpp", "ru"}},
+	{MessageID: 3, Library: "courses", Name: "Go concurrency patterns", Type: "course", Tags: []string{"go", "en"}},
+}
+
+// newTestServer returns a server backed by a memory store holding testPosts.
+func newTestServer(t *testing.T) (*Server, *memory.Store) {
+	t.Helper()
+	store := memory.New()
+	for i, post := range testPosts {
+		post.ChatID = 100
+		post.Timestamp = time.Date(2025, 1, 1, i, 0, 0, 0, time.UTC)
+		if err := store.SaveMessage(context.Background(), post); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewServer(store), store
+}
+
+// serve sends a request to the server and returns the recorded response.
+func serve(s *Server, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// decode unmarshals the JSON body of a response into v.
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+}
+
+// postsBody is the body of a /posts response.
+type postsBody struct {
+	Posts      []processor.ProcessedMessage `json:"posts"`
+	TotalCount int64                        `json:"total_count"`
+	Facets     *storage.Facets              `json:"facets"`
+}
+
+func TestHandleGetPosts(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	tests := []struct {
+		name      string
+		target    string
+		wantIDs   []int
+		wantTotal int64
+	}{
+		{"all posts newest first", "/posts", []int{3, 2, 1}, 3},
+		{"library", "/posts?library=books", []int{2, 1}, 2},
+		{"type", "/posts?type=course", []int{3}, 1},
+		{"tag", "/posts?tag=go", []int{3}, 1},
+		{"language", "/posts?language=ru", []int{2}, 1},
+		{"search", "/posts?search=learning", []int{1}, 1},
+		{"regular expression characters", "/posts?search=c%2B%2B", []int{2}, 1},
+		{"unbalanced parenthesis", "/posts?search=(", nil, 0},
+		{"language pattern", "/posts?language=.*", nil, 0},
+		{"pagination", "/posts?page=2&limit=2", []int{1}, 3},
+		{"invalid pagination uses defaults", "/posts?page=0&limit=x", []int{3, 2, 1}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(s, http.MethodGet, tt.target, nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+
+			var body postsBody
+			decode(t, rec, &body)
+			var ids []int
+			for _, post := range body.Posts {
+				ids = append(ids, post.MessageID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("posts = %v, want %v", ids, tt.wantIDs)
+			}
+			if body.TotalCount != tt.wantTotal {
+				t.Errorf("total_count = %d, want %d", body.TotalCount, tt.wantTotal)
+			}
+			if body.Facets != nil {
+				t.Errorf("facets = %+v, want none", body.Facets)
+			}
+		})
+	}
+}
+
+func TestHandleGetPostsFacets(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	rec := serve(s, http.MethodGet, "/posts?facets=true&language=en", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var body postsBody
+	decode(t, rec, &body)
+	if body.Facets == nil {
+		t.Fatal("facets missing")
+	}
+	wantTypes := []storage.FacetCount{{Value: "book", Count: 1}, {Value: "course", Count: 1}}
+	if !slices.Equal(body.Facets.Types, wantTypes) {
+		t.Errorf("type facets = %v, want %v", body.Facets.Types, wantTypes)
+	}
+	wantLanguages := []storage.FacetCount{{Value: "en", Count: 2}}
+	if !slices.Equal(body.Facets.Languages, wantLanguages) {
+		t.Errorf("language facets = %v, want %v", body.Facets.Languages, wantLanguages)
+	}
+}
+
+func TestHandleGetValues(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{"/tags", []string{"cpp", "en", "go", "ru"}},
+		{"/tags?library=courses", []string{"en", "go"}},
+		{"/languages", []string{"en", "ru"}},
+		{"/languages?library=courses", []string{"en"}},
+		{"/libraries", []string{"books", "courses"}},
+	}
+
+	for _, tt := range tests {
+		rec := serve(s, http.MethodGet, tt.target, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", tt.target, rec.Code, rec.Body)
+		}
+		var got []string
+		decode(t, rec, &got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestHandleSearch(t *testing.T) {
+	s, store := newTestServer(t)
+	index := search.NewIndex()
+	if err := index.Load(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+	s.EnableSearch(index)
+
+	if rec := serve(s, http.MethodGet, "/search?q=+", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("blank query: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec := serve(s, http.MethodGet, "/search?q=concurrency", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var results search.Results
+	decode(t, rec, &results)
+	if results.TotalCount != 1 || len(results.Hits) != 1 || results.Hits[0].Post.MessageID != 3 {
+		t.Errorf("results = %+v, want post 3", results)
+	}
+}
+
+func TestHandleGetPostFile(t *testing.T) {
+	s, store := newTestServer(t)
+	files, err := blob.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.EnableFileDownloads(files)
+
+	ctx := context.Background()
+	if err := files.Put(ctx, "books/guide.pdf", strings.NewReader("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	withFile := testPosts[0]
+	withFile.ChatID, withFile.MessageID = 100, 10
+	withFile.Attachment = &processor.Attachment{Kind: "document", FileName: "guide.pdf", MIMEType: "application/pdf", BlobKey: "books/guide.pdf"}
+	missingBlob := withFile
+	missingBlob.MessageID = 11
+	missingBlob.Attachment = &processor.Attachment{Kind: "document", BlobKey: "books/missing.pdf"}
+	for _, post := range []processor.ProcessedMessage{withFile, missingBlob} {
+		if err := store.SaveMessage(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		header http.Header
+		status int
+		body   string
+	}{
+		{"invalid chat ID", "/posts/x/10/file", nil, http.StatusBadRequest, ""},
+		{"invalid message ID", "/posts/100/x/file", nil, http.StatusBadRequest, ""},
+		{"missing post", "/posts/100/99/file", nil, http.StatusNotFound, ""},
+		{"post without file", "/posts/100/1/file", nil, http.StatusNotFound, ""},
+		{"missing blob", "/posts/100/11/file", nil, http.StatusNotFound, ""},
+		{"file", "/posts/100/10/file", nil, http.StatusOK, "0123456789"},
+		{"range", "/posts/100/10/file", http.Header{"Range": {"bytes=2-4"}}, http.StatusPartialContent, "234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(s, http.MethodGet, tt.target, tt.header)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.body == "" {
+				return
+			}
+			if got, _ := io.ReadAll(rec.Body); string(got) != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/pdf" {
+				t.Errorf("Content-Type = %q, want application/pdf", got)
+			}
+			if got := rec.Header().Get("Content-Disposition"); got != "attachment; filename=guide.pdf" {
+				t.Errorf("Content-Disposition = %q", got)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	rec := serve(s, http.MethodGet, "/healthz", http.Header{requestIDHeader: {"abc"}})
+	if got := rec.Header().Get(requestIDHeader); got != "abc" {
+		t.Errorf("echoed request ID = %q, want abc", got)
+	}
+
+	rec = serve(s, http.MethodGet, "/healthz", http.Header{requestIDHeader: {strings.Repeat("x", maxRequestIDLength+1)}})
+	if got := rec.Header().Get(requestIDHeader); got == "" || len(got) > maxRequestIDLength {
+		t.Errorf("request ID = %q, want a generated ID", got)
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	rec := serve(s, http.MethodOptions, "/posts", nil)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds the time all readiness checks together may take.
+const readinessTimeout = 5 * time.Second
+
+// ReadinessCheck reports whether a dependency of the service is usable.
+// It returns an error if the dependency is not ready, and optionally
+// details that are included in the readiness report either way.
+type ReadinessCheck func(ctx context.Context) (details any, err error)
+
+// readinessCheck is a named readiness check.
+type readinessCheck struct {
+	name  string
+	check ReadinessCheck
+}
+
+// checkResult is the outcome of a single readiness check.
+type checkResult struct {
+	Status    string  `json:"status"`            // "ok" or "failed"
+	LatencyMS float64 `json:"latency_ms"`        // Time the check took, in milliseconds
+	Error     string  `json:"error,omitempty"`   // Why the check failed
+	Details   any     `json:"details,omitempty"` // Additional information reported by the check
+}
+
+// handleGetHealth handles HTTP GET requests for the health of the pipeline components.
+// It responds with 503 Service Unavailable if any component has not started yet,
+// is restarting or has failed.
+func (s *Server) handleGetHealth(ctx *gin.Context) {
+	status, code := "ok", http.StatusOK
+	if !s.supervisor.Healthy() {
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+
+	ctx.JSON(code, gin.H{
+		"status":     status,
+		"components": s.supervisor.Status(),
+	})
+}
+
+// handleGetLiveness handles HTTP GET requests checking that the process is alive.
+// It always succeeds as long as the server can respond.
+func (s *Server) handleGetLiveness(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// handleGetReadiness handles HTTP GET requests checking that the service can do its work.
+// All readiness checks run concurrently; the response lists the result of each one
+// and is 503 Service Unavailable if any of them failed.
+func (s *Server) handleGetReadiness(ctx *gin.Context) {
+	checkCtx, cancel := context.WithTimeout(ctx.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	results := make(map[string]checkResult, len(s.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range s.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			details, err := c.check(checkCtx)
+			result := checkResult{
+				Status:    "ok",
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+				Details:   details,
+			}
+			if err != nil {
+				result.Status = "failed"
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			results[c.name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	status, code := "ready", http.StatusOK
+	for _, result := range results {
+		if result.Status != "ok" {
+			status, code = "not_ready", http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	ctx.JSON(code, gin.H{
+		"status": status,
+		"checks": results,
+	})
+}
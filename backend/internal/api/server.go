@@ -4,29 +4,72 @@
 package api
 
 import (
-	"log"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/db"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/blob"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/logging"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/metrics"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/search"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/supervisor"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracer creates the spans of API requests.
+var tracer = otel.Tracer("github.com/kirinyoku/kirinyoku-space-web/backend/internal/api")
+
+const (
+	requestIDHeader    = "X-Request-ID" // Header carrying the correlation ID of a request
+	maxRequestIDLength = 128            // Longer client-provided IDs are replaced
+)
+
+// RetryFunc re-submits a message to the ingestion pipeline.
+type RetryFunc func(ctx context.Context, msg bot.Message) error
+
 // Server represents the HTTP server and its dependencies.
 type Server struct {
-	db     *db.DB      // Database connection
-	router *gin.Engine // HTTP router instance
+	db          storage.Store          // Repository of posts
+	files       blob.Store             // Storage of mirrored attachments, nil if downloads are disabled
+	index       *search.Index          // Search index of posts, nil if search is disabled
+	deadLetters deadletter.Store       // Store of failed messages, nil if its endpoints are disabled
+	retry       RetryFunc              // Re-submits dead-lettered messages
+	supervisor  *supervisor.Supervisor // Tracks the health of the pipeline components
+	checks      []readinessCheck       // Checks run by the readiness endpoint
+	router      *gin.Engine            // HTTP router instance
+	http        *http.Server           // HTTP server serving the router
 }
 
 // NewServer creates and initializes a new Server instance.
-// It takes a database connection as parameter and sets up the routes.
-func NewServer(db *db.DB) *Server {
-	router := gin.Default()
+// It takes the repository of posts as parameter and sets up the routes.
+func NewServer(db storage.Store) *Server {
+	router := gin.New()
 
+	router.Use(gin.Recovery())
+	router.Use(tracingMiddleware())
+	router.Use(requestIDMiddleware())
+	router.Use(metricsMiddleware())
 	router.Use(corsMiddleware())
 
 	s := &Server{
 		db:     db,
 		router: router,
+		http:   &http.Server{Handler: router},
 	}
 
 	s.setupRoutes()
@@ -40,9 +83,9 @@ func corsMiddleware() gin.HandlerFunc {
 		// Allow requests from the frontend origin
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		// Allow specific methods
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
 		// Allow specific headers (if needed)
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Range, Authorization, X-Request-ID, traceparent, tracestate")
 
 		// Handle preflight OPTIONS requests
 		if c.Request.Method == "OPTIONS" {
@@ -55,19 +98,182 @@ func corsMiddleware() gin.HandlerFunc {
 	}
 }
 
+// tracingMiddleware starts a server span for every request, continuing the
+// trace of the caller if the request carries a W3C traceparent header.
+// Database queries made while handling the request become its child spans.
+func tracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		name := c.Request.Method
+		if route != "" {
+			name += " " + route
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(c.Request.Method),
+			semconv.HTTPRoute(route),
+			semconv.URLPath(c.Request.URL.Path),
+		))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(
+			semconv.HTTPResponseStatusCode(status),
+			attribute.String(logging.CorrelationIDKey, logging.CorrelationID(c.Request.Context())),
+		)
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// requestIDMiddleware tags every request with a correlation ID, taken from the
+// X-Request-ID header or generated, which is echoed in the response and attached
+// to the request context, so the logs of the request and its database queries share it.
+// Each request is logged once it completes.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = logging.NewID()
+		}
+		c.Header(requestIDHeader, id)
+
+		ctx := logging.WithCorrelationID(c.Request.Context(), id)
+		c.Request = c.Request.WithContext(ctx)
+
+		start := time.Now()
+		c.Next()
+
+		slog.InfoContext(ctx, "Handled request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", c.FullPath(),
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	}
+}
+
+// metricsMiddleware records the latency of every request by method, route and status code.
+// Requests that match no route are recorded under the route "unmatched".
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// adminMiddleware rejects requests that do not carry the admin token
+// as a bearer token in the Authorization header
+func adminMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // setupRoutes configures all the routes for the HTTP server.
-// It sets up endpoints for retrieving posts (with search and tag filtering)
-// and getting all available tags.
+// It sets up endpoints for retrieving posts (with search, tag and library filtering)
+// and getting all available tags, languages and libraries.
 func (s *Server) setupRoutes() {
 	s.router.GET("/posts", s.handleGetPosts)
 	s.router.GET("/tags", s.handleGetTags)
 	s.router.GET("/languages", s.handleGetLanguages)
+	s.router.GET("/libraries", s.handleGetLibraries)
+	s.router.GET("/healthz", s.handleGetLiveness)
+	s.router.GET("/readyz", s.handleGetReadiness)
+	s.router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+}
+
+// RegisterWebhook mounts a handler for Telegram webhook updates on the given path.
+// It must be called before Start.
+func (s *Server) RegisterWebhook(path string, handler http.Handler) {
+	s.router.POST(path, gin.WrapH(handler))
+}
+
+// EnableFileDownloads serves mirrored post attachments from the given store.
+// It must be called before Start.
+func (s *Server) EnableFileDownloads(files blob.Store) {
+	s.files = files
+	s.router.GET("/posts/:chat_id/:message_id/file", s.handleGetPostFile)
+}
+
+// EnableSearch serves ranked searches with highlighted snippets from the
+// given index at /search. It must be called before Start.
+func (s *Server) EnableSearch(index *search.Index) {
+	s.index = index
+	s.router.GET("/search", s.handleSearch)
+}
+
+// EnableDeadLetters exposes endpoints for listing, inspecting, retrying and
+// discarding dead-lettered messages. Retried messages are passed to retry.
+// The endpoints require the admin token, which must not be empty.
+// It must be called before Start.
+func (s *Server) EnableDeadLetters(deadLetters deadletter.Store, retry RetryFunc, adminToken string) {
+	s.deadLetters = deadLetters
+	s.retry = retry
+
+	admin := s.router.Group("/dead-letters", adminMiddleware(adminToken))
+	admin.GET("", s.handleListDeadLetters)
+	admin.GET("/:id", s.handleGetDeadLetter)
+	admin.POST("/:id/retry", s.handleRetryDeadLetter)
+	admin.DELETE("/:id", s.handleDeleteDeadLetter)
+}
+
+// AddReadinessCheck registers a check run by the /readyz endpoint.
+// It must be called before Start.
+func (s *Server) AddReadinessCheck(name string, check ReadinessCheck) {
+	s.checks = append(s.checks, readinessCheck{name: name, check: check})
+}
 
+// EnableHealth exposes the status of the supervised components at /health,
+// so that monitoring notices when a pipeline stage stops working.
+// It must be called before Start.
+func (s *Server) EnableHealth(supervisor *supervisor.Supervisor) {
+	s.supervisor = supervisor
+	s.router.GET("/health", s.handleGetHealth)
 }
 
 // Start begins listening for HTTP requests on the specified address.
+// It blocks until the server is stopped, in which case it returns nil.
 // Returns an error if the server fails to start.
 func (s *Server) Start(addr string) error {
-	log.Printf("Starting API server on %s", addr)
-	return s.router.Run(addr)
+	slog.Info("Starting API server", "addr", addr)
+
+	s.http.Addr = addr
+	if err := s.http.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop gracefully shuts down the server: it stops accepting connections and
+// waits for active requests to finish, or until ctx is done, in which case
+// ctx.Err() is returned.
+func (s *Server) Stop(ctx context.Context) error {
+	if err := s.http.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	slog.Info("API server stopped")
+	return nil
 }
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	inMemory = tracetest.NewInMemoryExporter() // Records the spans of the server
+	install  sync.Once
+)
+
+// recordSpans clears the recorded spans and returns the exporter recording
+// them. The tracer provider is only installed once, because package tracers
+// keep using the first provider installed.
+func recordSpans() *tracetest.InMemoryExporter {
+	install.Do(func() {
+		tracing.Install(sdktrace.NewTracerProvider(sdktrace.WithSyncer(inMemory)))
+	})
+	inMemory.Reset()
+	return inMemory
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	exporter := recordSpans()
+	s, _ := newTestServer(t)
+
+	// A caller's span, whose context the request carries in its traceparent header
+	ctx, caller := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "frontend")
+	header := http.Header{}
+	for name, value := range tracing.Inject(ctx) {
+		header.Set(name, value)
+	}
+	caller.End()
+
+	if rec := serve(s, http.MethodGet, "/posts?tag=go", header); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+
+	if span.Name != "GET /posts" || span.SpanKind != trace.SpanKindServer {
+		t.Errorf("span = %q of kind %v, want the server span GET /posts", span.Name, span.SpanKind)
+	}
+	if span.SpanContext.TraceID() != caller.SpanContext().TraceID() || span.Parent.SpanID() != caller.SpanContext().SpanID() {
+		t.Errorf("span has parent %v, want the caller's span %v", span.Parent, caller.SpanContext())
+	}
+
+	attributes := attribute.NewSet(span.Attributes...)
+	for key, want := range map[attribute.Key]attribute.Value{
+		"http.request.method":       attribute.StringValue(http.MethodGet),
+		"http.route":                attribute.StringValue("/posts"),
+		"http.response.status_code": attribute.IntValue(http.StatusOK),
+	} {
+		if got, ok := attributes.Value(key); !ok || got != want {
+			t.Errorf("attribute %s = %v, want %v", key, got.Emit(), want.Emit())
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Package blob provides storage for binary objects such as files attached to
+// channel posts. Objects are addressed by slash-separated keys; the Store
+// interface allows backends to be swapped, with the local filesystem
+// implemented by FileStore.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when no object is stored under the requested key.
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned when a key is empty or would escape the store.
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Object is a stored blob opened for reading. Seeking allows serving
+// byte ranges of the content.
+type Object struct {
+	io.ReadSeekCloser           // Content of the object
+	Size              int64     // Size of the content in bytes
+	ModTime           time.Time // Time the object was last written
+}
+
+// Store is implemented by blob storage backends.
+type Store interface {
+	// Put stores the content read from r under key, replacing any existing object.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open returns the object stored under key, or ErrNotFound.
+	Open(ctx context.Context, key string) (*Object, error)
+	// Exists reports whether an object is stored under key.
+	Exists(ctx context.Context, key string) (bool, error)
+}
@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Attachment kinds recognised in channel posts.
+const (
+	AttachmentDocument = "document"
+	AttachmentPhoto    = "photo"
+	AttachmentVideo    = "video"
+	AttachmentAudio    = "audio"
+)
+
+// Attachment describes a file attached to a Telegram message.
+type Attachment struct {
+	Kind         string `json:"kind" bson:"kind"`                               // Kind of attachment, one of the Attachment* constants
+	FileID       string `json:"file_id" bson:"file_id"`                         // Identifier used to download the file through the Bot API
+	FileUniqueID string `json:"file_unique_id" bson:"file_unique_id"`           // Identifier that stays the same for the same file
+	FileName     string `json:"file_name,omitempty" bson:"file_name,omitempty"` // Original file name, empty for photos
+	MIMEType     string `json:"mime_type,omitempty" bson:"mime_type,omitempty"` // MIME type of the file as reported by Telegram
+	Size         int64  `json:"size,omitempty" bson:"size,omitempty"`           // File size in bytes, 0 if unknown
+}
+
+// FetchFile downloads the file with the given ID through the Bot API.
+// The file path is resolved with getFile and the content is requested from
+// the file endpoint; the caller must close the returned reader.
+// Returns an error if the file is unknown, too big for the Bot API or the
+// download fails.
+func (b *Bot) FetchFile(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	file, err := b.api.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+
+	url := fmt.Sprintf(b.fileEndpoint, b.api.Token, file.FilePath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file request: %w", err)
+	}
+
+	resp, err := b.api.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download file: unexpected status %s", resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// extractAttachment returns the file attached to a post, or nil if the post
+// has none. For photos, the largest of the available sizes is used.
+func extractAttachment(post *tgbotapi.Message) *Attachment {
+	switch {
+	case post.Document != nil:
+		return &Attachment{
+			Kind:         AttachmentDocument,
+			FileID:       post.Document.FileID,
+			FileUniqueID: post.Document.FileUniqueID,
+			FileName:     post.Document.FileName,
+			MIMEType:     post.Document.MimeType,
+			Size:         int64(post.Document.FileSize),
+		}
+
+	case len(post.Photo) > 0:
+		// Telegram sends photo sizes in ascending order
+		photo := post.Photo[len(post.Photo)-1]
+		return &Attachment{
+			Kind:         AttachmentPhoto,
+			FileID:       photo.FileID,
+			FileUniqueID: photo.FileUniqueID,
+			MIMEType:     "image/jpeg", // Telegram re-encodes photos as JPEG
+			Size:         int64(photo.FileSize),
+		}
+
+	case post.Video != nil:
+		return &Attachment{
+			Kind:         AttachmentVideo,
+			FileID:       post.Video.FileID,
+			FileUniqueID: post.Video.FileUniqueID,
+			FileName:     post.Video.FileName,
+			MIMEType:     post.Video.MimeType,
+			Size:         int64(post.Video.FileSize),
+		}
+
+	case post.Audio != nil:
+		return &Attachment{
+			Kind:         AttachmentAudio,
+			FileID:       post.Audio.FileID,
+			FileUniqueID: post.Audio.FileUniqueID,
+			FileName:     post.Audio.FileName,
+			MIMEType:     post.Audio.MimeType,
+			Size:         int64(post.Audio.FileSize),
+		}
+	}
+
+	return nil
+}
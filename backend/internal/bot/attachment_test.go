@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot/bottest"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/queue"
+)
+
+// newTestBot returns a bot talking to the Bot API server at apiURL.
+func newTestBot(t *testing.T, apiURL string) *Bot {
+	t.Helper()
+	q, err := queue.Open[Message](filepath.Join(t.TempDir(), "messages.log"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+
+	b, err := New(bottest.Token, apiURL, map[int64]string{-100: "books"}, q)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return b
+}
+
+func TestFetchFile(t *testing.T) {
+	server := bottest.NewServer(t)
+	server.AddFile("doc", []byte("%PDF-1.7"))
+	server.AddFile("expired", nil)
+	b := newTestBot(t, server.URL+"/")
+
+	content, err := b.FetchFile(context.Background(), "doc")
+	if err != nil {
+		t.Fatalf("FetchFile: %v", err)
+	}
+	data, err := io.ReadAll(content)
+	content.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "%PDF-1.7" {
+		t.Errorf("content = %q, want the served file", data)
+	}
+
+	for _, fileID := range []string{"unknown", "expired"} {
+		if _, err := b.FetchFile(context.Background(), fileID); err == nil {
+			t.Errorf("FetchFile(%q) succeeded, want an error", fileID)
+		}
+	}
+}
+
+func TestExtractAttachment(t *testing.T) {
+	tests := []struct {
+		name string
+		post *tgbotapi.Message
+		want *Attachment
+	}{
+		{
+			name: "document",
+			post: &tgbotapi.Message{Document: &tgbotapi.Document{FileID: "d", FileUniqueID: "ud", FileName: "book.pdf", MimeType: "application/pdf", FileSize: 1024}},
+			want: &Attachment{Kind: AttachmentDocument, FileID: "d", FileUniqueID: "ud", FileName: "book.pdf", MIMEType: "application/pdf", Size: 1024},
+		},
+		{
+			name: "largest photo size",
+			post: &tgbotapi.Message{Photo: []tgbotapi.PhotoSize{
+				{FileID: "small", FileUniqueID: "us", Width: 90, FileSize: 100},
+				{FileID: "large", FileUniqueID: "ul", Width: 1280, FileSize: 9000},
+			}},
+			want: &Attachment{Kind: AttachmentPhoto, FileID: "large", FileUniqueID: "ul", MIMEType: "image/jpeg", Size: 9000},
+		},
+		{
+			name: "video",
+			post: &tgbotapi.Message{Video: &tgbotapi.Video{FileID: "v", FileUniqueID: "uv", FileName: "talk.mp4", MimeType: "video/mp4", FileSize: 2048}},
+			want: &Attachment{Kind: AttachmentVideo, FileID: "v", FileUniqueID: "uv", FileName: "talk.mp4", MIMEType: "video/mp4", Size: 2048},
+		},
+		{
+			name: "audio",
+			post: &tgbotapi.Message{Audio: &tgbotapi.Audio{FileID: "a", FileUniqueID: "ua", FileName: "talk.mp3", MimeType: "audio/mpeg", FileSize: 512}},
+			want: &Attachment{Kind: AttachmentAudio, FileID: "a", FileUniqueID: "ua", FileName: "talk.mp3", MIMEType: "audio/mpeg", Size: 512},
+		},
+		{
+			name: "text post",
+			post: &tgbotapi.Message{Text: "Go"},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractAttachment(tt.post); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractAttachment = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,146 +1,402 @@
 // Package bot provides functionality for interacting with the Telegram Bot API.
-// It handles message reception from a specified channel and forwards them through
-// a message channel for further processing.
+// It handles message reception from the monitored channels and appends them
+// to a durable queue for further processing.
 package bot
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf16"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/logging"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/metrics"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/queue"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/supervisor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Message represents a message received from Telegram containing the essential
 // information needed for processing.
 type Message struct {
-	Text   string // Raw text content of the message
-	URL    string // URL extracted from message entities
-	ChatID int64  // Identifier of the chat where message originated
+	Library       string            `json:"library" bson:"library"`                                   // Identifier of the library the message belongs to
+	Text          string            `json:"text" bson:"text"`                                         // Raw text content of the message, or its caption for media posts
+	URL           string            `json:"url" bson:"url"`                                           // Primary URL extracted from message entities
+	Links         []Link            `json:"links,omitempty" bson:"links,omitempty"`                   // All links found in message entities
+	ChatID        int64             `json:"chat_id" bson:"chat_id"`                                   // Identifier of the chat where message originated
+	ChatName      string            `json:"chat_name,omitempty" bson:"chat_name,omitempty"`           // Public username of the chat, empty for private channels
+	MessageID     int               `json:"message_id" bson:"message_id"`                             // Identifier of the message inside the chat
+	Date          time.Time         `json:"date" bson:"date"`                                         // Time the message was originally posted
+	Edited        bool              `json:"edited,omitempty" bson:"edited,omitempty"`                 // Whether the message is an edited version of an earlier post
+	Attachment    *Attachment       `json:"attachment,omitempty" bson:"attachment,omitempty"`         // File attached to the message, nil for text posts
+	CorrelationID string            `json:"correlation_id,omitempty" bson:"correlation_id,omitempty"` // Identifies the log records about the message's journey through the pipeline
+	TraceContext  map[string]string `json:"-" bson:"-"`                                               // Trace context of the span that queued the message, see tracing.Inject
+}
+
+// Link is a URL found in a message together with the text it is shown as.
+type Link struct {
+	URL  string `json:"url" bson:"url"`   // Target of the link
+	Text string `json:"text" bson:"text"` // Visible anchor text; equal to the URL for bare links
 }
 
 // Bot manages the Telegram bot operations including message listening,
 // processing and forwarding. It maintains connection with Telegram API
 // and handles graceful shutdown.
 type Bot struct {
-	api         *tgbotapi.BotAPI // Connection to Telegram Bot API
-	channelID   int64            // Target channel to monitor
-	messageChan chan Message     // Output channel for processed messages
-	done        chan struct{}    // Signal channel for shutdown
-	wg          sync.WaitGroup   // Ensures clean goroutine termination
+	api          *tgbotapi.BotAPI      // Connection to Telegram Bot API
+	fileEndpoint string                // URL format for downloading files, see tgbotapi.FileEndpoint
+	channels     map[int64]string      // Monitored channels mapped to their libraries
+	queue        *queue.Queue[Message] // Output queue for received messages
+	component    *supervisor.Component // Supervises polling and records received messages
+	lastPoll     atomic.Int64          // Unix time in nanoseconds of the last successful getUpdates request
+	stopping     context.Context       // Done once the bot is stopped
+	stop         context.CancelFunc    // Signals shutdown
+	wg           sync.WaitGroup        // Ensures clean goroutine termination
+}
+
+// pollClient is the HTTP client of the Bot API connection. It cancels
+// pending getUpdates requests once the bot is stopped, so that a long poll
+// does not hold up shutdown; other requests are left to complete.
+type pollClient struct {
+	client   *http.Client
+	stopping context.Context // Done once the bot is stopped
+}
+
+// Do sends an HTTP request, tying getUpdates requests to the bot's lifetime.
+func (c *pollClient) Do(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(req.URL.Path, "/getUpdates") {
+		req = req.WithContext(c.stopping)
+	}
+	return c.client.Do(req)
 }
 
+// tracer creates the spans of received updates.
+var tracer = otel.Tracer("github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot")
+
+// allowedUpdates lists the update types the bot subscribes to: new and edited channel posts.
+var allowedUpdates = []string{"channel_post", "edited_channel_post"}
+
+// DefaultAPIURL is the base URL of the public Telegram Bot API server.
+const DefaultAPIURL = "https://api.telegram.org"
+
 // ErrInvalidParams is returned when required initialization parameters are missing or invalid.
-var ErrInvalidParams = errors.New("invalid parameters: token or channelID empty, or messageChan nil")
+var ErrInvalidParams = errors.New("invalid parameters: token or channels empty, or queue nil")
 
 // New initializes a new Bot instance with the provided configuration.
+// apiURL is the base URL of the Bot API server, such as DefaultAPIURL or the
+// address of a self-hosted or stand-in server; an empty value selects DefaultAPIURL.
+// channels maps the IDs of monitored channels to the libraries their posts belong to.
 // It establishes connection with Telegram API and sets up message handling infrastructure.
 // Returns error if initialization fails due to invalid parameters or API connection issues.
-func New(token string, channelID int64, messageChan chan Message) (*Bot, error) {
-	if token == "" || channelID == 0 || messageChan == nil {
+// Received messages are appended to the queue.
+func New(token, apiURL string, channels map[int64]string, queue *queue.Queue[Message]) (*Bot, error) {
+	if token == "" || len(channels) == 0 || queue == nil {
 		return nil, ErrInvalidParams
 	}
 
-	botapi, err := tgbotapi.NewBotAPI(token)
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	apiURL = strings.TrimSuffix(apiURL, "/")
+
+	stopping, stop := context.WithCancel(context.Background())
+	client := &pollClient{client: &http.Client{}, stopping: stopping}
+
+	botapi, err := tgbotapi.NewBotAPIWithClient(token, apiURL+"/bot%s/%s", client)
 	if err != nil {
+		stop()
 		return nil, fmt.Errorf("failed to create bot API: %w", err)
 	}
 
 	return &Bot{
-		api:         botapi,
-		channelID:   channelID,
-		messageChan: messageChan,
-		done:        make(chan struct{}),
+		api:          botapi,
+		fileEndpoint: apiURL + "/file/bot%s/%s",
+		channels:     channels,
+		queue:        queue,
+		stopping:     stopping,
+		stop:         stop,
 	}, nil
 }
 
-// Start initiates the message monitoring process in a separate goroutine.
-// It configures update parameters to only listen for channel posts and
-// processes incoming messages, extracting URLs and forwarding them through
-// the message channel.
-func (b *Bot) Start() {
+// Start initiates the message monitoring process in a separate goroutine
+// using long polling, supervised by the given component, which restarts
+// polling after failed requests and records the time of every queued message.
+// Any previously configured webhook is removed first, since Telegram refuses
+// getUpdates requests while a webhook is set.
+// It configures update parameters to only listen for new and edited channel
+// posts and processes incoming messages, extracting URLs and appending them
+// to the message queue.
+func (b *Bot) Start(component *supervisor.Component) error {
+	b.component = component
+
+	if _, err := b.api.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
-	u.AllowedUpdates = []string{"channel_post"} // Only listen for channel posts
+	u.AllowedUpdates = allowedUpdates // Only listen for channel posts
+
+	b.poll(u)
 
-	updates := b.api.GetUpdatesChan(u)
+	slog.Info("Bot started, polling for messages", "channels", len(b.channels))
+	return nil
+}
 
+// poll requests updates in a separate goroutine until the bot is stopped.
+func (b *Bot) poll(config tgbotapi.UpdateConfig) {
 	b.wg.Add(1)
 	go func() {
 		defer b.wg.Done()
-		for {
-			select {
-			case update := <-updates:
-				if update.ChannelPost == nil {
-					continue
-				}
-
-				if update.ChannelPost.Chat.ID != b.channelID {
-					log.Printf("Received message from unexpected channel: %d", update.ChannelPost.Chat.ID)
-					continue
-				}
+		b.component.Run(b.stopping, func() error {
+			return b.receive(&config)
+		})
+	}()
+}
 
-				url := b.extractURLFromEntities(update.ChannelPost.Text, update.ChannelPost.Entities)
+// receive is the polling loop. Telegram keeps returning an update until a
+// request's offset moves past it, so the offset is only advanced once the
+// update's message is safely queued; updates that were not queued before a
+// crash are received again. While the queue is full, polling pauses and
+// updates wait on Telegram's side. It returns nil once the bot is stopped,
+// and an error if updates cannot be received or queued.
+func (b *Bot) receive(config *tgbotapi.UpdateConfig) error {
+	for b.stopping.Err() == nil {
+		updates, err := b.api.GetUpdates(*config)
+		if b.stopping.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get updates: %w", err)
+		}
+		b.lastPoll.Store(time.Now().UnixNano())
 
-				msg := Message{
-					Text:   update.ChannelPost.Text,
-					URL:    url,
-					ChatID: update.ChannelPost.Chat.ID,
+		for _, update := range updates {
+			if err := b.handleUpdate(b.stopping, update); err != nil {
+				if b.stopping.Err() != nil {
+					return nil
 				}
-
-				b.sendMessage(msg)
-
-			case <-b.done:
-				return
+				return fmt.Errorf("failed to queue update %d: %w", update.UpdateID, err)
 			}
+			config.Offset = update.UpdateID + 1
 		}
-	}()
+	}
 
-	log.Printf("Bot started, listening for messages from channel %d", b.channelID)
+	return nil
 }
 
-// Stop gracefully terminates the bot's operations.
-// It signals the monitoring goroutine to stop and waits for its completion.
-func (b *Bot) Stop() {
-	close(b.done)
-	b.wg.Wait()
-	log.Printf("Bot stopped")
+// LastPoll returns the time of the last successful getUpdates request,
+// or the zero time if there was none, e.g. because the bot uses a webhook.
+func (b *Bot) LastPoll() time.Time {
+	nanos := b.lastPoll.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos).UTC()
 }
 
-// sendMessage attempts to send a message through the output channel.
-// It logs the operation result and handles cases where the channel is full.
-// Empty messages are skipped to avoid processing invalid data.
-func (b *Bot) sendMessage(msg Message) {
+// handleUpdate converts a channel post from a monitored channel into a
+// message and appends it to the queue, waiting while the queue is full.
+// Other updates are ignored. Returns an error if the message could not be queued.
+func (b *Bot) handleUpdate(ctx context.Context, update tgbotapi.Update) (err error) {
+	post, edited := update.ChannelPost, false
+	if post == nil {
+		post, edited = update.EditedChannelPost, true
+	}
+	if post == nil {
+		return nil
+	}
+
+	kind := "new"
+	if edited {
+		kind = "edited"
+	}
+
+	ctx, span := tracer.Start(ctx, "bot.handle_update", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(
+		attribute.Int("telegram.update_id", update.UpdateID),
+		attribute.Int64("telegram.chat_id", post.Chat.ID),
+		attribute.Int("telegram.message_id", post.MessageID),
+		attribute.Bool("telegram.edited", edited),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	library, ok := b.channels[post.Chat.ID]
+	if !ok {
+		slog.WarnContext(ctx, "Received message from unexpected channel", "chat_id", post.Chat.ID, "message_id", post.MessageID)
+		metrics.BotUpdates.WithLabelValues(kind, "ignored").Inc()
+		span.SetAttributes(attribute.String("outcome", "ignored"))
+		return nil
+	}
+
+	msg := NewMessage(post, library, edited)
+	ctx = logging.WithCorrelationID(ctx, msg.CorrelationID)
+	span.SetAttributes(attribute.String("library", library), attribute.String(logging.CorrelationIDKey, msg.CorrelationID))
 	if msg.Text == "" {
-		log.Printf("Skipping empty message")
-		return
+		slog.InfoContext(ctx, "Skipping empty message", "chat_id", msg.ChatID, "message_id", msg.MessageID)
+		metrics.BotUpdates.WithLabelValues(kind, "empty").Inc()
+		span.SetAttributes(attribute.String("outcome", "empty"))
+		return nil
 	}
 
+	// Later stages continue the trace of the update
+	msg.TraceContext = tracing.Inject(ctx)
+	if err := b.queue.Put(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "Failed to queue message", "chat_id", msg.ChatID, "message_id", msg.MessageID, "error", err)
+		metrics.BotUpdates.WithLabelValues(kind, "failed").Inc()
+		return err
+	}
+
+	metrics.BotUpdates.WithLabelValues(kind, "queued").Inc()
+	span.SetAttributes(attribute.String("outcome", "queued"))
+
+	b.component.Beat()
+	slog.InfoContext(ctx, "Message queued",
+		"update_id", update.UpdateID,
+		"library", msg.Library,
+		"chat_id", msg.ChatID,
+		"message_id", msg.MessageID,
+		"edited", msg.Edited,
+	)
+	return nil
+}
+
+// Stop gracefully terminates the bot's operations: polling ends, a pending
+// long poll is cancelled and the webhook handler starts rejecting updates,
+// which Telegram keeps and delivers again later. It waits for the polling
+// goroutine to finish, or until ctx is done, in which case ctx.Err() is returned.
+func (b *Bot) Stop(ctx context.Context) error {
+	b.stop()
+
+	if err := wait(ctx, &b.wg); err != nil {
+		return err
+	}
+
+	slog.Info("Bot stopped")
+	return nil
+}
+
+// wait blocks until the wait group's counter drops to zero or ctx is done.
+// Returns ctx.Err() in the latter case.
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
 	select {
-	case b.messageChan <- msg:
-		log.Printf("Message sent to channel:\n%s", msg.Text)
-	default:
-		log.Printf("Message channel full, skipping message:\n%s", msg.Text)
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewMessage converts a Telegram channel post into a Message, extracting the
+// links and the primary URL from its entities. Media posts carry their text
+// in the caption, which is used when the post has no text of its own.
+// The message is assigned to the given library, and the edited flag marks
+// posts received as edits.
+// Every message gets a new correlation ID.
+func NewMessage(post *tgbotapi.Message, library string, edited bool) Message {
+	text, entities := post.Text, post.Entities
+	if text == "" {
+		text, entities = post.Caption, post.CaptionEntities
 	}
+
+	links, url := extractLinksFromEntities(text, entities)
+
+	return Message{
+		Library:       library,
+		Text:          text,
+		URL:           url,
+		Links:         links,
+		ChatID:        post.Chat.ID,
+		ChatName:      post.Chat.UserName,
+		MessageID:     post.MessageID,
+		Date:          time.Unix(int64(post.Date), 0).UTC(),
+		Edited:        edited,
+		Attachment:    extractAttachment(post),
+		CorrelationID: logging.NewID(),
+	}
+}
+
+// Enqueue hands a message to the processing pipeline as if it had just been
+// received, e.g. to retry a dead-lettered message. It waits for room in the
+// queue until ctx is done.
+func (b *Bot) Enqueue(ctx context.Context, msg Message) error {
+	msg.TraceContext = tracing.Inject(ctx)
+	return b.queue.Put(ctx, msg)
 }
 
-// extractURLFromEntities searches for a URL in message entities specifically
-// associated with the "link" text. It validates entity boundaries and handles
-// potential edge cases in entity processing.
-// Returns an empty string if no valid URL is found or if input is invalid.
-func (b *Bot) extractURLFromEntities(text string, entities []tgbotapi.MessageEntity) string {
+// extractLinksFromEntities collects the links of all "text_link" and "url"
+// entities in the order they appear in the message, skipping repeated URLs.
+// Entity offsets and lengths are measured in UTF-16 code units, so the text
+// is converted to UTF-16 before the anchor text of each entity is sliced out.
+// Entities that fall outside the text are ignored.
+// The primary URL is the first "text_link", since posts conventionally link
+// the resource itself with anchor text, falling back to the first bare link.
+// Returns no links and an empty primary URL if input is invalid.
+func extractLinksFromEntities(text string, entities []tgbotapi.MessageEntity) (links []Link, primary string) {
 	if text == "" || entities == nil {
-		return ""
+		return nil, ""
 	}
 
+	encoded := utf16.Encode([]rune(text))
+	seen := make(map[string]bool)
+
+	var firstBare string
 	for _, entity := range entities {
-		if entity.Type != "text_link" || entity.URL == "" {
+		if entity.Type != "text_link" && entity.Type != "url" {
+			continue
+		}
+
+		if entity.Offset < 0 || entity.Length <= 0 || entity.Offset+entity.Length > len(encoded) {
 			continue
 		}
+		anchor := string(utf16.Decode(encoded[entity.Offset : entity.Offset+entity.Length]))
+
+		url := entity.URL
+		if entity.Type == "url" {
+			// The visible text is the link itself; Telegram also detects links without a scheme
+			url = anchor
+			if !strings.Contains(url, "://") {
+				url = "https://" + url
+			}
+		}
+
+		if url == "" {
+			continue
+		}
+
+		if entity.Type == "text_link" && primary == "" {
+			primary = url
+		}
+		if entity.Type == "url" && firstBare == "" {
+			firstBare = url
+		}
+
+		if seen[url] {
+			continue
+		}
+		seen[url] = true
+
+		links = append(links, Link{URL: url, Text: anchor})
+	}
 
-		return entity.URL
+	if primary == "" {
+		primary = firstBare
 	}
 
-	return ""
+	return links, primary
 }
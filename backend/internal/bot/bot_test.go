@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestExtractLinksFromEntities(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		entities    []tgbotapi.MessageEntity
+		wantLinks   []Link
+		wantPrimary string
+	}{
+		{
+			name:        "bare link after emoji",
+			text:        "🚀 Docs: go.dev",
+			entities:    []tgbotapi.MessageEntity{{Type: "url", Offset: 9, Length: 6}},
+			wantLinks:   []Link{{URL: "https://go.dev", Text: "go.dev"}},
+			wantPrimary: "https://go.dev",
+		},
+		{
+			name:        "text link after flag",
+			text:        "🇺🇦 Книга",
+			entities:    []tgbotapi.MessageEntity{{Type: "text_link", Offset: 5, Length: 5, URL: "https://example.com/book"}},
+			wantLinks:   []Link{{URL: "https://example.com/book", Text: "Книга"}},
+			wantPrimary: "https://example.com/book",
+		},
+		{
+			name:        "non-BMP anchor text",
+			text:        "Read 𝔾𝕠 now",
+			entities:    []tgbotapi.MessageEntity{{Type: "text_link", Offset: 5, Length: 4, URL: "https://go.dev"}},
+			wantLinks:   []Link{{URL: "https://go.dev", Text: "𝔾𝕠"}},
+			wantPrimary: "https://go.dev",
+		},
+		{
+			name:        "link after joined emoji sequence",
+			text:        "👨‍👩‍👧 https://a.dev",
+			entities:    []tgbotapi.MessageEntity{{Type: "url", Offset: 9, Length: 13}},
+			wantLinks:   []Link{{URL: "https://a.dev", Text: "https://a.dev"}},
+			wantPrimary: "https://a.dev",
+		},
+		{
+			name: "text link is primary, repeated links are skipped",
+			text: "🔗 a.dev 📘 Book 🔗 a.dev",
+			entities: []tgbotapi.MessageEntity{
+				{Type: "url", Offset: 3, Length: 5},
+				{Type: "bold", Offset: 12, Length: 4},
+				{Type: "text_link", Offset: 12, Length: 4, URL: "https://b.dev"},
+				{Type: "url", Offset: 20, Length: 5},
+			},
+			wantLinks:   []Link{{URL: "https://a.dev", Text: "a.dev"}, {URL: "https://b.dev", Text: "Book"}},
+			wantPrimary: "https://b.dev",
+		},
+		{
+			name: "entities outside the text",
+			text: "🚀 go.dev",
+			entities: []tgbotapi.MessageEntity{
+				{Type: "url", Offset: 3, Length: 7},
+				{Type: "url", Offset: -1, Length: 2},
+				{Type: "url", Offset: 3, Length: 0},
+			},
+		},
+		{
+			name:     "byte offsets are not UTF-16 offsets",
+			text:     "🚀 go.dev",
+			entities: []tgbotapi.MessageEntity{{Type: "url", Offset: 5, Length: 6}},
+		},
+		{
+			name:     "no entities",
+			text:     "🚀 go.dev",
+			entities: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, primary := extractLinksFromEntities(tt.text, tt.entities)
+			if !reflect.DeepEqual(links, tt.wantLinks) {
+				t.Errorf("links = %+v, want %+v", links, tt.wantLinks)
+			}
+			if primary != tt.wantPrimary {
+				t.Errorf("primary = %q, want %q", primary, tt.wantPrimary)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// Package bottest provides a stand-in for the Telegram Bot API server, so
+// that code talking to it can be tested without network access. Point the
+// bot at it the way TELEGRAM_API_URL does in production, by passing the
+// server's URL to bot.New.
+package bottest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Token is the bot token the server accepts.
+const Token = "123:test-token"
+
+// Server is a Bot API server answering getMe and getFile and serving the
+// content of the files added with AddFile from its file endpoint.
+type Server struct {
+	*httptest.Server
+	mu        sync.Mutex
+	paths     map[string]string // File paths by file ID
+	contents  map[string][]byte // File contents by file path
+	downloads int               // Number of successful file downloads
+}
+
+// NewServer starts a Server that is closed when the test ends.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		paths:    make(map[string]string),
+		contents: make(map[string][]byte),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// AddFile makes a file known to getFile. Unless content is nil, it can also
+// be downloaded; a nil content makes downloads fail with 404 Not Found, like
+// an expired file link.
+func (s *Server) AddFile(fileID string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := "documents/" + fileID
+	s.paths[fileID] = path
+	if content != nil {
+		s.contents[path] = content
+	}
+}
+
+// Downloads returns the number of files downloaded from the file endpoint.
+func (s *Server) Downloads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.downloads
+}
+
+// serve handles Bot API methods and file downloads.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if path, ok := strings.CutPrefix(r.URL.Path, "/file/bot"+Token+"/"); ok {
+		content, ok := s.contents[path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		s.downloads++
+		w.Write(content)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/bot" + Token + "/getMe":
+		respond(w, map[string]any{"id": 123, "is_bot": true, "first_name": "Test", "username": "test_bot"})
+	case "/bot" + Token + "/getFile":
+		fileID := r.FormValue("file_id")
+		path, ok := s.paths[fileID]
+		if !ok {
+			fail(w, http.StatusBadRequest, "Bad Request: invalid file_id")
+			return
+		}
+		respond(w, map[string]any{"file_id": fileID, "file_unique_id": "unique-" + fileID, "file_path": path})
+	default:
+		fail(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// respond writes a successful Bot API response with the given result.
+func respond(w http.ResponseWriter, result any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+}
+
+// fail writes a failed Bot API response.
+func fail(w http.ResponseWriter, status int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"ok": false, "error_code": status, "description": description})
+}
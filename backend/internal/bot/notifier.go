@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/logging"
+)
+
+// postFormatHint reminds authors of the layout a library post must follow.
+const postFormatHint = "Expected format:\nName: <title>\nType: <type>\nTags: #tag1 #tag2 #en\nplus a link or an attached file."
+
+// Notifier reports posts that could not be added to the library to an
+// administrators' chat, so that their authors learn what to fix.
+type Notifier struct {
+	bot     *Bot           // Bot used to send reports
+	chatID  int64          // Chat receiving the reports
+	pending sync.WaitGroup // Reports still being sent
+}
+
+// Notifier returns a Notifier that sends reports to the given chat.
+func (b *Bot) Notifier(chatID int64) *Notifier {
+	return &Notifier{bot: b, chatID: chatID}
+}
+
+// ReportFailure sends a report describing why the message was rejected,
+// with a link to the offending post. The report is sent in the background,
+// so a slow Telegram API does not hold up message processing; failures to
+// send are logged.
+func (n *Notifier) ReportFailure(msg Message, err error) {
+	report := tgbotapi.NewMessage(n.chatID, formatReport(msg, err))
+	report.DisableWebPagePreview = true
+
+	n.pending.Add(1)
+	go func() {
+		defer n.pending.Done()
+		ctx := logging.WithCorrelationID(context.Background(), msg.CorrelationID)
+		if _, err := n.bot.api.Send(report); err != nil {
+			slog.ErrorContext(ctx, "Failed to send report", "chat_id", msg.ChatID, "message_id", msg.MessageID, "error", err)
+			return
+		}
+		slog.InfoContext(ctx, "Sent report", "chat_id", msg.ChatID, "message_id", msg.MessageID, "admin_chat_id", n.chatID)
+	}()
+}
+
+// Stop waits until the reports already being sent are delivered, or until
+// ctx is done, in which case ctx.Err() is returned. It must be called once
+// no more failures are reported.
+func (n *Notifier) Stop(ctx context.Context) error {
+	return wait(ctx, &n.pending)
+}
+
+// formatReport builds the text of a report about a rejected message,
+// including the error that names the missing or unparsable field.
+func formatReport(msg Message, err error) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Post was not added to the library %q.\n\n", msg.Library)
+	fmt.Fprintf(&b, "Problem: %v\n\n", err)
+	b.WriteString(postFormatHint)
+	b.WriteString("\n\n")
+	b.WriteString(PostLink(msg.ChatID, msg.ChatName, msg.MessageID))
+
+	return b.String()
+}
+
+// PostLink returns the t.me link of a channel post. Public channels are
+// linked by username; private channels use the t.me/c/ form, which only
+// works for channel members.
+func PostLink(chatID int64, chatName string, messageID int) string {
+	if chatName != "" {
+		return fmt.Sprintf("https://t.me/%s/%d", chatName, messageID)
+	}
+
+	// Bot API IDs of channels are -100 followed by the channel's own ID
+	internalID := strings.TrimPrefix(fmt.Sprint(chatID), "-100")
+	return fmt.Sprintf("https://t.me/c/%s/%d", internalID, messageID)
+}
@@ -0,0 +1,80 @@
+package bot
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/supervisor"
+)
+
+// secretTokenHeader is the header Telegram uses to send the secret token
+// configured with setWebhook.
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// StartWebhook registers the given public URL as the bot's webhook and starts
+// processing updates delivered to WebhookHandler. Telegram includes the secret
+// token in every request, which lets the handler reject forged updates.
+// The given component is marked as running once the webhook is set, and records
+// the time of every queued message.
+// Returns an error if Telegram refuses the webhook configuration.
+func (b *Bot) StartWebhook(url, secretToken string, component *supervisor.Component) error {
+	b.component = component
+
+	allowed, err := json.Marshal(allowedUpdates)
+	if err != nil {
+		return fmt.Errorf("failed to encode allowed updates: %w", err)
+	}
+
+	// The library's WebhookConfig has no secret token field, so the request is built by hand
+	params := tgbotapi.Params{
+		"url":             url,
+		"secret_token":    secretToken,
+		"allowed_updates": string(allowed),
+	}
+	if _, err := b.api.MakeRequest("setWebhook", params); err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+	b.component.Started()
+
+	slog.Info("Bot started, receiving messages via webhook", "channels", len(b.channels), "url", url)
+	return nil
+}
+
+// WebhookHandler returns an HTTP handler that accepts updates pushed by
+// Telegram. Requests without the expected secret token are rejected with
+// 401 Unauthorized. Accepted updates are handled like polled updates, and
+// the request is only answered once the message is safely queued. If the
+// queue is full, the handler waits until there is room or the request is
+// cancelled, in which case Telegram retries the delivery later. Once the bot
+// is stopped, updates are rejected with 503 Service Unavailable.
+func (b *Bot) WebhookHandler(secretToken string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if b.stopping.Err() != nil {
+			http.Error(w, "bot is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+
+		token := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secretToken)) != 1 {
+			http.Error(w, "invalid secret token", http.StatusUnauthorized)
+			return
+		}
+
+		update, err := b.api.HandleUpdate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := b.handleUpdate(r.Context(), *update); err != nil {
+			http.Error(w, "update not queued", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/tracing"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// DeadLetters stores messages that failed processing or persistence
+// in a MongoDB collection. It implements deadletter.Store.
+type DeadLetters struct {
+	collection *mongo.Collection // Collection holding dead-letter entries
+}
+
+// NewDeadLetters returns a dead-letter store backed by the named collection
+// in the same database as the posts, and creates its index.
+// Returns an error if index creation fails.
+func (db *DB) NewDeadLetters(collection string) (*DeadLetters, error) {
+	d := &DeadLetters{
+		collection: db.collection.Database().Collection(collection),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Index on updated_at for listing the most recent failures first
+	index := mongo.IndexModel{
+		Keys: bson.D{{Key: "updated_at", Value: -1}},
+	}
+	if _, err := d.collection.Indexes().CreateOne(ctx, index); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Record upserts the entry of a failed message, replacing the stored message,
+// stage and error with the latest ones and incrementing the attempt count.
+func (d *DeadLetters) Record(ctx context.Context, msg bot.Message, stage deadletter.Stage, failure error) error {
+	// Finish the write even if the pipeline stage is being aborted
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	filter := bson.D{{Key: "_id", Value: deadletter.EntryID(msg.ChatID, msg.MessageID)}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "message", Value: msg},
+			{Key: "stage", Value: stage},
+			{Key: "error", Value: failure.Error()},
+			{Key: "updated_at", Value: now},
+		}},
+		{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+		{Key: "$setOnInsert", Value: bson.D{{Key: "created_at", Value: now}}},
+	}
+
+	opCtx, span := startSpan(ctx, d.collection, "updateOne")
+	_, err := d.collection.UpdateOne(opCtx, filter, update, options.UpdateOne().SetUpsert(true))
+	tracing.End(span, err)
+	return err
+}
+
+// Resolve removes the entry of a message, if there is one.
+func (d *DeadLetters) Resolve(ctx context.Context, chatID int64, messageID int) error {
+	// Finish the write even if the pipeline stage is being aborted
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	opCtx, span := startSpan(ctx, d.collection, "deleteOne")
+	_, err := d.collection.DeleteOne(opCtx, bson.D{{Key: "_id", Value: deadletter.EntryID(chatID, messageID)}})
+	tracing.End(span, err)
+	return err
+}
+
+// List retrieves dead-letter entries with pagination, most recent failures first
+func (d *DeadLetters) List(ctx context.Context, page, limit int) (deadletter.Page, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	defer logQuery(ctx, "dead_letters", time.Now())
+
+	skip := (page - 1) * limit
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: -1}}).
+		SetSkip(int64(skip)).
+		SetLimit(int64(limit))
+
+	opCtx, span := startSpan(ctx, d.collection, "countDocuments")
+	total, err := d.collection.CountDocuments(opCtx, bson.D{})
+	tracing.End(span, err)
+	if err != nil {
+		return deadletter.Page{}, err
+	}
+
+	opCtx, span = startSpan(ctx, d.collection, "find")
+	cur, err := d.collection.Find(opCtx, bson.D{}, opts)
+	tracing.End(span, err)
+	if err != nil {
+		return deadletter.Page{}, err
+	}
+	defer cur.Close(ctx)
+
+	entries := []deadletter.Entry{}
+	if err := cur.All(ctx, &entries); err != nil {
+		return deadletter.Page{}, err
+	}
+
+	return deadletter.Page{Entries: entries, TotalCount: total}, nil
+}
+
+// Get retrieves a single dead-letter entry.
+// Returns deadletter.ErrNotFound if no such entry exists.
+func (d *DeadLetters) Get(ctx context.Context, id string) (deadletter.Entry, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	defer logQuery(ctx, "dead_letter", time.Now())
+
+	var entry deadletter.Entry
+	opCtx, span := startSpan(ctx, d.collection, "findOne")
+	err := d.collection.FindOne(opCtx, bson.D{{Key: "_id", Value: id}}).Decode(&entry)
+	tracing.End(span, ignoreNoDocuments(err))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return deadletter.Entry{}, deadletter.ErrNotFound
+	}
+	if err != nil {
+		return deadletter.Entry{}, err
+	}
+
+	return entry, nil
+}
+
+// Delete discards a dead-letter entry.
+// Returns deadletter.ErrNotFound if no such entry exists.
+func (d *DeadLetters) Delete(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer logQuery(ctx, "delete_dead_letter", time.Now())
+
+	opCtx, span := startSpan(ctx, d.collection, "deleteOne")
+	result, err := d.collection.DeleteOne(opCtx, bson.D{{Key: "_id", Value: id}})
+	tracing.End(span, err)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return deadletter.ErrNotFound
+	}
+
+	return nil
+}
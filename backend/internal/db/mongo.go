@@ -4,29 +4,37 @@ package db
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/tracing"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/translit"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// DB manages MongoDB operations including connection management,
-// data storage, and asynchronous message processing.
+// tracer creates the spans of database operations.
+var tracer = otel.Tracer("github.com/kirinyoku/kirinyoku-space-web/backend/internal/db")
+
+// DB manages MongoDB operations including connection management
+// and data storage. It implements storage.Store.
 type DB struct {
-	client     *mongo.Client                   // MongoDB client connection
-	collection *mongo.Collection               // Target collection for storing messages
-	inputChan  chan processor.ProcessedMessage // Channel for receiving processed messages
+	client     *mongo.Client     // MongoDB client connection
+	collection *mongo.Collection // Target collection for storing messages
 }
 
 // New creates and initializes a new DB instance with the specified MongoDB connection parameters.
 // It establishes a connection to MongoDB, verifies connectivity with a ping test,
 // and sets up the required collection and indexes.
 // Returns an error if connection, ping, or index creation fails.
-func New(uri, database, collection string, inputChan chan processor.ProcessedMessage) (*DB, error) {
+func New(uri, database, collection string) (*DB, error) {
 	// Configure client options with connection timeout
 	clientOptions := options.Client().ApplyURI(uri).SetConnectTimeout(10 * time.Second)
 
@@ -50,7 +58,6 @@ func New(uri, database, collection string, inputChan chan processor.ProcessedMes
 	db := &DB{
 		client:     client,
 		collection: coll,
-		inputChan:  inputChan,
 	}
 
 	// Create necessary indexes for efficient querying
@@ -58,73 +65,194 @@ func New(uri, database, collection string, inputChan chan processor.ProcessedMes
 		return nil, err
 	}
 
-	return db, nil
-}
-
-// Start begins the message processing loop in a separate goroutine.
-// It continuously reads from the input channel and persists each message to MongoDB.
-// Errors during save operations are logged but don't interrupt processing.
-func (db *DB) Start() {
-	go func() {
-		for message := range db.inputChan {
-			if err := db.saveMessage(message); err != nil {
-				log.Printf("Failed to save message %s: %v", message.Name, err)
-				continue
-			}
-
-			log.Printf("Saved message\n%s", message)
-		}
-	}()
+	// Fold the names of posts saved by earlier versions for transliterated search
+	if err := db.fillFoldedNames(); err != nil {
+		return nil, err
+	}
 
-	log.Println("DB started, listening for processed messages")
+	return db, nil
 }
 
-// saveMessage persists a processed message to MongoDB.
-// It converts the message to BSON format and inserts it into the collection.
-// Uses a timeout context to prevent hanging operations.
-func (db *DB) saveMessage(message processor.ProcessedMessage) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// SaveMessage persists a processed message to MongoDB.
+// It converts the message to BSON format and upserts it into the collection,
+// keyed on the Telegram chat and message IDs, so saving the same post again
+// (for example an edit or a replayed update) replaces the stored fields
+// instead of creating a duplicate. The ingestion time is only set when the
+// document is first inserted.
+// Uses a timeout context derived from ctx to prevent hanging operations.
+func (db *DB) SaveMessage(ctx context.Context, message processor.ProcessedMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	// Convert message to BSON document format
 	doc := bson.D{
+		{Key: "library", Value: message.Library},
 		{Key: "name", Value: message.Name},
+		{Key: "name_translit", Value: translit.Fold(message.Name)},
 		{Key: "type", Value: message.Type},
+		{Key: "description", Value: message.Description},
 		{Key: "tags", Value: message.Tags},
 		{Key: "url", Value: message.URL},
+		{Key: "links", Value: message.Links},
+		{Key: "timestamp", Value: message.Timestamp},
+		{Key: "attachment", Value: message.Attachment},
+	}
+
+	filter := bson.D{
+		{Key: "chat_id", Value: message.ChatID},
+		{Key: "message_id", Value: message.MessageID},
+	}
+	update := bson.D{
+		{Key: "$set", Value: doc},
+		{Key: "$setOnInsert", Value: bson.D{{Key: "ingested_at", Value: time.Now().UTC()}}},
 	}
 
-	// Insert document into collection
-	_, err := db.collection.InsertOne(ctx, doc)
+	// Insert the document or update the previously stored version in place
+	opCtx, span := startSpan(ctx, db.collection, "updateOne")
+	_, err := db.collection.UpdateOne(opCtx, filter, update, options.UpdateOne().SetUpsert(true))
+	tracing.End(span, err)
 	return err
 }
 
+// startSpan starts a client span for a MongoDB operation on the collection.
+// The operation must be run with the returned context, so that it is traced
+// under the span, and the span must be ended with tracing.End.
+func startSpan(ctx context.Context, collection *mongo.Collection, operation string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, operation+" "+collection.Name(), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.DBSystemMongoDB,
+		semconv.DBCollectionName(collection.Name()),
+		semconv.DBOperationName(operation),
+	))
+}
+
 // createIndex sets up MongoDB indexes to optimize query performance.
-// Creates a multi-key index on tags for efficient tag-based lookups
-// and a text index on name for text search capabilities.
+// Creates a multi-key index on tags for efficient tag-based lookups,
+// a unique index on chat_id and message_id that backs upserts, a descending
+// index on timestamp for newest-first listings, an index on library and
+// timestamp for per-library listings, and a weighted text index on name,
+// folded name, tags and description for ranked search, replacing the text
+// indexes created by earlier versions.
 func (db *DB) createIndex() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if err := db.dropLegacyTextIndexes(ctx); err != nil {
+		return err
+	}
+
 	// Index on tags (multi-key index for arrays)
 	tagsIndex := mongo.IndexModel{
 		Keys: bson.D{{Key: "tags", Value: 1}},
 	}
-	// Index on name (text index for search)
-	nameIndex := mongo.IndexModel{
-		Keys: bson.D{{Key: "name", Value: "text"}},
+	// Unique index on chat_id and message_id so each Telegram post is stored once.
+	// Documents saved before these fields existed are excluded from the index.
+	messageIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "chat_id", Value: 1}, {Key: "message_id", Value: 1}},
+		Options: options.Index().
+			SetName("chat_id_message_id_unique").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.D{
+				{Key: "chat_id", Value: bson.D{{Key: "$exists", Value: true}}},
+				{Key: "message_id", Value: bson.D{{Key: "$exists", Value: true}}},
+			}),
+	}
+	// Index on timestamp for sorting posts newest-first
+	timestampIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "timestamp", Value: -1}},
+	}
+	// Index on library and timestamp for listing the posts of one library
+	libraryIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "library", Value: 1}, {Key: "timestamp", Value: -1}},
+	}
+	// Text index for search. Posts are written in several languages, so
+	// words are neither stemmed nor filtered as stop words of one language.
+	searchTextIndex := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "name", Value: "text"},
+			{Key: "name_translit", Value: "text"},
+			{Key: "tags", Value: "text"},
+			{Key: "description", Value: "text"},
+		},
+		Options: options.Index().
+			SetName(searchIndex).
+			SetWeights(searchWeights).
+			SetDefaultLanguage("none"),
+	}
+
+	// Create all indexes in a single operation
+	_, err := db.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{tagsIndex, messageIndex, timestampIndex, libraryIndex, searchTextIndex})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Indexes created on tags, chat_id/message_id, timestamp, library and search text")
+	return nil
+}
+
+// dropLegacyTextIndexes drops the text indexes created by earlier versions,
+// if the collection still has one.
+func (db *DB) dropLegacyTextIndexes(ctx context.Context) error {
+	specs, err := db.collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return err
 	}
 
-	// Create both indexes in a single operation
-	_, err := db.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{tagsIndex, nameIndex})
+	for _, spec := range specs {
+		if slices.Contains(legacyTextIndexes, spec.Name) {
+			slog.Info("Dropping legacy text index", "index", spec.Name)
+			if err := db.collection.Indexes().DropOne(ctx, spec.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fillFoldedNames stores the folded names of the posts saved before names
+// were folded, so that transliterated searches find them too.
+func (db *DB) fillFoldedNames() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	filter := bson.D{{Key: "name_translit", Value: bson.D{{Key: "$exists", Value: false}}}}
+	cur, err := db.collection.Find(ctx, filter, options.Find().SetProjection(bson.D{{Key: "name", Value: 1}}))
 	if err != nil {
 		return err
 	}
+	defer cur.Close(ctx)
 
-	log.Println("Indexes created on tags and name")
+	var updates []mongo.WriteModel
+	for cur.Next(ctx) {
+		var post struct {
+			ID   bson.ObjectID `bson:"_id"`
+			Name string        `bson:"name"`
+		}
+		if err := cur.Decode(&post); err != nil {
+			return err
+		}
+		updates = append(updates, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: post.ID}}).
+			SetUpdate(bson.D{{Key: "$set", Value: bson.D{{Key: "name_translit", Value: translit.Fold(post.Name)}}}}))
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	if _, err := db.collection.BulkWrite(ctx, updates, options.BulkWrite().SetOrdered(false)); err != nil {
+		return err
+	}
+	slog.Info("Folded the names of stored posts", "posts", len(updates))
 	return nil
 }
 
+// Ping checks that the MongoDB primary is reachable.
+func (db *DB) Ping(ctx context.Context) error {
+	return db.client.Ping(ctx, readpref.Primary())
+}
+
 // Disconnect cleanly closes the MongoDB connection.
 // Should be called when the application is shutting down to release resources.
 func (db *DB) Disconnect() error {
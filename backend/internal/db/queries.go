@@ -2,66 +2,61 @@ package db
 
 import (
 	"context"
+	"errors"
+	"log/slog"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/tracing"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
-// PostsResponse represents the response structure for post queries
-type PostsResponse struct {
-	Posts      []processor.ProcessedMessage
-	TotalCount int64
-}
-
-// GetPostsWithFilters retrieves posts with specified filters and pagination
-// query: search term for post name
+// GetPostsWithFilters retrieves posts with specified filters and pagination,
+// ordered from the newest to the oldest Telegram post, or from the most to
+// the least relevant one when searching with the text index
+// query: search terms matched against post names, tags and descriptions;
+// "quoted phrases" must match and -prefixed words must not; transliterated
+// and wrong-layout words match folded names (see searchFilter)
 // tag: specific tag to filter by
 // postType: type of post to filter
-// language: language tag to filter
+// language: language of the posts, which must be their last tag
+// library: library the posts belong to
 // page: page number for pagination
 // limit: number of posts per page
-func (d *DB) GetPostsWithFilters(query, tag, postType, language string, page, limit int) (PostsResponse, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (d *DB) GetPostsWithFilters(ctx context.Context, query, tag, postType, language, library string, page, limit int) (response storage.PostsResponse, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
+	defer logQuery(ctx, "posts", time.Now())
 
-	skip := (page - 1) * limit
-	opts := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit))
+	ctx, span := tracer.Start(ctx, "db.posts")
+	defer func() { tracing.End(span, err) }()
 
-	filter := bson.M{}
-	if query != "" {
-		filter["name"] = bson.M{"$regex": query, "$options": "i"}
-	}
-	if postType != "" {
-		filter["type"] = postType
-	}
-
-	var tagConditions []bson.M
-	if tag != "" {
-		tagConditions = append(tagConditions, bson.M{"tags": tag})
-	}
-	if language != "" {
-		tagConditions = append(tagConditions, bson.M{"tags": bson.M{"$regex": language + "$"}})
-	}
-	if len(tagConditions) > 0 {
-		if len(tagConditions) == 1 {
-			filter["tags"] = tagConditions[0]["tags"]
-		} else {
-			filter["$and"] = tagConditions
-		}
+	filter, ranked := postsFilter(query, tag, postType, language, library)
+	skip := (page - 1) * limit
+	opts := options.Find().
+		SetSkip(int64(skip)).
+		SetLimit(int64(limit))
+	if ranked {
+		opts.SetProjection(bson.D{{Key: "score", Value: textScore}})
 	}
 
-	total, err := d.collection.CountDocuments(ctx, filter)
+	opCtx, opSpan := startSpan(ctx, d.collection, "countDocuments")
+	total, err := d.collection.CountDocuments(opCtx, filter)
+	tracing.End(opSpan, err)
 	if err != nil {
-		return PostsResponse{}, err
+		return storage.PostsResponse{}, err
 	}
 
-	cur, err := d.collection.Find(ctx, filter, opts)
+	opCtx, opSpan = startSpan(ctx, d.collection, "find")
+	cur, err := d.collection.Find(opCtx, filter, opts.SetSort(postsSort(ranked)))
+	tracing.End(opSpan, err)
 	if err != nil {
-		return PostsResponse{}, err
+		return storage.PostsResponse{}, err
 	}
 	defer cur.Close(ctx)
 
@@ -69,7 +64,7 @@ func (d *DB) GetPostsWithFilters(query, tag, postType, language string, page, li
 	for cur.Next(ctx) {
 		var msg processor.ProcessedMessage
 		if err := cur.Decode(&msg); err != nil {
-			return PostsResponse{}, err
+			return storage.PostsResponse{}, err
 		}
 		for i, tag := range msg.Tags {
 			msg.Tags[i] = strings.TrimPrefix(tag, "#")
@@ -78,50 +73,234 @@ func (d *DB) GetPostsWithFilters(query, tag, postType, language string, page, li
 	}
 
 	if err := cur.Err(); err != nil {
-		return PostsResponse{}, err
+		return storage.PostsResponse{}, err
 	}
 
-	return PostsResponse{Posts: posts, TotalCount: total}, nil
+	return storage.PostsResponse{Posts: posts, TotalCount: total}, nil
+}
+
+// GetPostsWithFacets is like GetPostsWithFilters, but also counts the types,
+// tags and languages of all matching posts. The page of posts, their number
+// and the counts are computed by a single $facet aggregation, so they come
+// from the same snapshot in one round trip.
+func (d *DB) GetPostsWithFacets(ctx context.Context, query, tag, postType, language, library string, page, limit int) (response storage.PostsResponse, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	defer logQuery(ctx, "posts with facets", time.Now())
+
+	ctx, span := tracer.Start(ctx, "db.posts")
+	defer func() { tracing.End(span, err) }()
+
+	filter, ranked := postsFilter(query, tag, postType, language, library)
+
+	// A limit of 0 means no limit, like in GetPostsWithFilters
+	postsPipeline := bson.A{bson.D{{Key: "$skip", Value: max(page-1, 0) * max(limit, 0)}}}
+	if limit > 0 {
+		postsPipeline = append(postsPipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+	// Facet values are ordered from the most to the least frequent
+	byCount := bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}}
+	count := bson.D{{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$sort", Value: postsSort(ranked)}},
+		{{Key: "$facet", Value: bson.D{
+			{Key: "posts", Value: postsPipeline},
+			{Key: "total", Value: bson.A{bson.D{{Key: "$count", Value: "count"}}}},
+			{Key: "types", Value: bson.A{
+				bson.D{{Key: "$match", Value: bson.D{{Key: "type", Value: bson.D{{Key: "$nin", Value: bson.A{"", nil}}}}}}},
+				bson.D{{Key: "$group", Value: append(bson.D{{Key: "_id", Value: "$type"}}, count...)}},
+				byCount,
+			}},
+			// A post is counted once for each of its distinct tags
+			{Key: "tags", Value: bson.A{
+				bson.D{{Key: "$project", Value: bson.D{{Key: "tags", Value: bson.D{{Key: "$setUnion", Value: bson.A{"$tags", bson.A{}}}}}}}},
+				bson.D{{Key: "$unwind", Value: "$tags"}},
+				bson.D{{Key: "$group", Value: append(bson.D{{Key: "_id", Value: "$tags"}}, count...)}},
+				byCount,
+			}},
+			// The language of a post is its last tag, if it consists of two lowercase letters
+			{Key: "languages", Value: bson.A{
+				bson.D{{Key: "$project", Value: bson.D{{Key: "lastTag", Value: bson.D{{Key: "$arrayElemAt", Value: bson.A{"$tags", -1}}}}}}},
+				bson.D{{Key: "$match", Value: bson.D{{Key: "lastTag", Value: bson.D{{Key: "$regex", Value: "^[a-z]{2}$"}}}}}},
+				bson.D{{Key: "$group", Value: append(bson.D{{Key: "_id", Value: "$lastTag"}}, count...)}},
+				byCount,
+			}},
+		}}},
+	}
+
+	aggregateCtx, aggregateSpan := startSpan(ctx, d.collection, "aggregate")
+	cur, err := d.collection.Aggregate(aggregateCtx, pipeline)
+	tracing.End(aggregateSpan, err)
+	if err != nil {
+		return storage.PostsResponse{}, err
+	}
+	defer cur.Close(ctx)
+
+	// The $facet stage outputs a single document
+	var result struct {
+		Posts []processor.ProcessedMessage `bson:"posts"`
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+		Types     []facetCount `bson:"types"`
+		Tags      []facetCount `bson:"tags"`
+		Languages []facetCount `bson:"languages"`
+	}
+	if cur.Next(ctx) {
+		if err := cur.Decode(&result); err != nil {
+			return storage.PostsResponse{}, err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return storage.PostsResponse{}, err
+	}
+
+	for _, post := range result.Posts {
+		for i, tag := range post.Tags {
+			post.Tags[i] = strings.TrimPrefix(tag, "#")
+		}
+	}
+	response = storage.PostsResponse{
+		Posts: result.Posts,
+		Facets: &storage.Facets{
+			Types:     facetCounts(result.Types, ""),
+			Tags:      facetCounts(result.Tags, "#"),
+			Languages: facetCounts(result.Languages, ""),
+		},
+	}
+	if len(result.Total) > 0 {
+		response.TotalCount = result.Total[0].Count
+	}
+	return response, nil
+}
+
+// textScore is the relevance of a post to a $text search.
+var textScore = bson.M{"$meta": "textScore"}
+
+// postsFilter returns the filter implementing the filters of
+// GetPostsWithFilters and whether its matches can be ranked by text score.
+func postsFilter(query, tag, postType, language, library string) (filter bson.M, ranked bool) {
+	filter = bson.M{}
+	if library != "" {
+		filter["library"] = library
+	}
+	if query != "" {
+		var condition bson.E
+		condition, ranked = searchFilter(query)
+		filter[condition.Key] = condition.Value
+	}
+	if postType != "" {
+		filter["type"] = postType
+	}
+
+	if tag != "" {
+		filter["tags"] = tag
+	}
+	if language != "" {
+		// The language of a post is its last tag
+		filter["$expr"] = bson.M{"$eq": bson.A{bson.M{"$arrayElemAt": bson.A{"$tags", -1}}, language}}
+	}
+
+	return filter, ranked
+}
+
+// postsSort orders posts from the newest to the oldest, or from the most to
+// the least relevant if they are ranked; equally relevant posts stay newest first.
+func postsSort(ranked bool) bson.D {
+	sort := bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}
+	if ranked {
+		sort = append(bson.D{{Key: "score", Value: textScore}}, sort...)
+	}
+	return sort
+}
+
+// facetCount is a value of a facet and the number of posts with it, as
+// grouped by the $facet stage of GetPostsWithFacets.
+type facetCount struct {
+	Value string `bson:"_id"`
+	Count int64  `bson:"count"`
+}
+
+// facetCounts converts grouped facet values, removing prefix from values.
+// The result is never nil, so it is encoded as an empty JSON array.
+func facetCounts(counts []facetCount, prefix string) []storage.FacetCount {
+	result := make([]storage.FacetCount, len(counts))
+	for i, count := range counts {
+		result[i] = storage.FacetCount{Value: strings.TrimPrefix(count.Value, prefix), Count: count.Count}
+	}
+	return result
+}
+
+// GetPost retrieves the post stored for a Telegram message.
+// Returns storage.ErrNotFound if no such post exists.
+func (d *DB) GetPost(ctx context.Context, chatID int64, messageID int) (processor.ProcessedMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	defer logQuery(ctx, "post", time.Now())
+
+	filter := bson.D{
+		{Key: "chat_id", Value: chatID},
+		{Key: "message_id", Value: messageID},
+	}
+
+	var post processor.ProcessedMessage
+	opCtx, span := startSpan(ctx, d.collection, "findOne")
+	err := d.collection.FindOne(opCtx, filter).Decode(&post)
+	tracing.End(span, ignoreNoDocuments(err))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return processor.ProcessedMessage{}, storage.ErrNotFound
+	}
+	if err != nil {
+		return processor.ProcessedMessage{}, err
+	}
+
+	return post, nil
 }
 
 // GetPosts retrieves all posts with pagination
-func (d *DB) GetPosts(page, limit int) (PostsResponse, error) {
-	return d.GetPostsWithFilters("", "", "", "", page, limit)
+func (d *DB) GetPosts(ctx context.Context, page, limit int) (storage.PostsResponse, error) {
+	return d.GetPostsWithFilters(ctx, "", "", "", "", "", page, limit)
 }
 
 // GetPostsByTag retrieves posts with a specific tag
-func (d *DB) GetPostsByTag(tag string, page, limit int) (PostsResponse, error) {
-	return d.GetPostsWithFilters("", tag, "", "", page, limit)
+func (d *DB) GetPostsByTag(ctx context.Context, tag string, page, limit int) (storage.PostsResponse, error) {
+	return d.GetPostsWithFilters(ctx, "", tag, "", "", "", page, limit)
 }
 
 // GetPostsByType retrieves posts of a specific type
-func (d *DB) GetPostsByType(postType string, page, limit int) (PostsResponse, error) {
-	return d.GetPostsWithFilters("", "", postType, "", page, limit)
+func (d *DB) GetPostsByType(ctx context.Context, postType string, page, limit int) (storage.PostsResponse, error) {
+	return d.GetPostsWithFilters(ctx, "", "", postType, "", "", page, limit)
 }
 
 // GetPostsByLanguage retrieves posts in a specific language
-func (d *DB) GetPostsByLanguage(language string, page, limit int) (PostsResponse, error) {
-	return d.GetPostsWithFilters("", "", "", language, page, limit)
+func (d *DB) GetPostsByLanguage(ctx context.Context, language string, page, limit int) (storage.PostsResponse, error) {
+	return d.GetPostsWithFilters(ctx, "", "", "", language, "", page, limit)
 }
 
 // SearchPosts searches posts by query string
-func (d *DB) SearchPosts(query string, page, limit int) (PostsResponse, error) {
-	return d.GetPostsWithFilters(query, "", "", "", page, limit)
+func (d *DB) SearchPosts(ctx context.Context, query string, page, limit int) (storage.PostsResponse, error) {
+	return d.GetPostsWithFilters(ctx, query, "", "", "", "", page, limit)
 }
 
-// GetTags retrieves all unique tags from the collection
-func (d *DB) GetTags() ([]string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// GetTags retrieves all unique tags from the collection,
+// limited to the posts of one library unless library is empty
+func (d *DB) GetTags(ctx context.Context, library string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
+	defer logQuery(ctx, "tags", time.Now())
 
-	pipeline := mongo.Pipeline{
-		{{"$unwind", "$tags"}},
-		{{"$group", bson.D{{"_id", "$tags"}}}},
-		{{"$sort", bson.D{{"_id", 1}}}},
-		{{"$project", bson.D{{"tag", "$_id"}, {"_id", 0}}}},
-	}
+	pipeline := append(libraryStage(library),
+		bson.D{{Key: "$unwind", Value: "$tags"}},
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$tags"}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$project", Value: bson.D{{Key: "tag", Value: "$_id"}, {Key: "_id", Value: 0}}}},
+	)
 
-	cur, err := d.collection.Aggregate(ctx, pipeline)
+	opCtx, span := startSpan(ctx, d.collection, "aggregate")
+	cur, err := d.collection.Aggregate(opCtx, pipeline)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, err
 	}
@@ -148,20 +327,24 @@ func (d *DB) GetTags() ([]string, error) {
 	return tags, nil
 }
 
-// GetLanguages retrieves all unique language codes from tags
-func (d *DB) GetLanguages() ([]string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// GetLanguages retrieves all unique language codes from tags,
+// limited to the posts of one library unless library is empty
+func (d *DB) GetLanguages(ctx context.Context, library string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
+	defer logQuery(ctx, "languages", time.Now())
 
-	pipeline := mongo.Pipeline{
-		{{"$project", bson.D{{"lastTag", bson.M{"$arrayElemAt": []interface{}{"$tags", -1}}}}}},
-		{{"$match", bson.D{{"lastTag", bson.M{"$regex": "^[a-z]{2}$"}}}}},
-		{{"$group", bson.D{{"_id", "$lastTag"}}}},
-		{{"$sort", bson.D{{"_id", 1}}}},
-		{{"$project", bson.D{{"language", "$_id"}, {"_id", 0}}}},
-	}
+	pipeline := append(libraryStage(library),
+		bson.D{{Key: "$project", Value: bson.D{{Key: "lastTag", Value: bson.M{"$arrayElemAt": []interface{}{"$tags", -1}}}}}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "lastTag", Value: bson.M{"$regex": "^[a-z]{2}$"}}}}},
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$lastTag"}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$project", Value: bson.D{{Key: "language", Value: "$_id"}, {Key: "_id", Value: 0}}}},
+	)
 
-	cur, err := d.collection.Aggregate(ctx, pipeline)
+	opCtx, span := startSpan(ctx, d.collection, "aggregate")
+	cur, err := d.collection.Aggregate(opCtx, pipeline)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, err
 	}
@@ -187,3 +370,51 @@ func (d *DB) GetLanguages() ([]string, error) {
 	}
 	return languages, nil
 }
+
+// GetLibraries retrieves the identifiers of all libraries that have posts
+func (d *DB) GetLibraries(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	defer logQuery(ctx, "libraries", time.Now())
+
+	// Posts stored before libraries were introduced have no library
+	filter := bson.D{{Key: "library", Value: bson.D{{Key: "$type", Value: "string"}}}}
+
+	var libraries []string
+	opCtx, span := startSpan(ctx, d.collection, "distinct")
+	err := d.collection.Distinct(opCtx, "library", filter).Decode(&libraries)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if libraries == nil {
+		return []string{}, nil
+	}
+	sort.Strings(libraries)
+	return libraries, nil
+}
+
+// libraryStage returns the aggregation stages restricting a pipeline to the
+// posts of one library, or an empty pipeline if library is empty
+func libraryStage(library string) mongo.Pipeline {
+	if library == "" {
+		return mongo.Pipeline{}
+	}
+	return mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "library", Value: library}}}}}
+}
+
+// ignoreNoDocuments returns nil for mongo.ErrNoDocuments, so that looking up
+// a missing document is not traced as a failure
+func ignoreNoDocuments(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	return err
+}
+
+// logQuery records the duration of a query at debug level, tagged with the
+// correlation ID of the request that issued it
+func logQuery(ctx context.Context, query string, start time.Time) {
+	slog.DebugContext(ctx, "Query finished", "query", query, "duration_ms", time.Since(start).Milliseconds())
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/translit"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// searchIndex is the name of the weighted text index that backs search.
+const searchIndex = "search_translit_text"
+
+// legacyTextIndexes are the names of the text indexes created by earlier
+// versions: on names alone, and on names, tags and descriptions without
+// folded names. A collection can only have one text index, so they are
+// dropped before searchIndex is created.
+var legacyTextIndexes = []string{"name_text", "search_text"}
+
+// minTextSearchLength is the length, in characters, below which a query is
+// matched as the prefix of a word of the name instead of with the text
+// index, which only matches whole words.
+const minTextSearchLength = 3
+
+// searchWeights rank matches in names above matches in tags, and matches in
+// tags above matches in descriptions.
+// Folded names rank like names.
+var searchWeights = bson.D{
+	{Key: "name", Value: 10},
+	{Key: "name_translit", Value: 10},
+	{Key: "tags", Value: 5},
+	{Key: "description", Value: 1},
+}
+
+// searchQuery is a parsed search query rendered for $text.
+type searchQuery struct {
+	storage.SearchQuery
+}
+
+// withVariants returns the query with the variants of its words added as
+// further words, so that transliterated and wrong-layout words match folded
+// names, see translit.Variants. Quotes and leading "-" are removed from
+// variants, which would otherwise be read as phrases or exclusions.
+func (q searchQuery) withVariants() searchQuery {
+	terms := make([]string, 0, len(q.Terms))
+	seen := make(map[string]bool)
+	for _, term := range q.Terms {
+		for _, variant := range translit.Variants(term) {
+			variant = strings.TrimLeft(strings.ReplaceAll(variant, `"`, " "), "-")
+			if strings.TrimSpace(variant) != "" && !seen[variant] {
+				seen[variant] = true
+				terms = append(terms, variant)
+			}
+		}
+	}
+	q.Terms = terms
+	return q
+}
+
+// String renders the query in the syntax of $search.
+func (q searchQuery) String() string {
+	parts := make([]string, 0, len(q.Terms)+len(q.Phrases)+len(q.Excluded))
+	parts = append(parts, q.Terms...)
+	for _, phrase := range q.Phrases {
+		parts = append(parts, `"`+phrase+`"`)
+	}
+	for _, excluded := range q.Excluded {
+		if strings.Contains(excluded, " ") {
+			parts = append(parts, `-"`+excluded+`"`)
+		} else {
+			parts = append(parts, "-"+excluded)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// searchFilter returns the filter on a search query and whether its matches
+// can be ranked by text score. Queries shorter than minTextSearchLength, or
+// without anything to search for, match names in which a word starts with
+// the literal query, or folded names in which a word starts with a variant
+// of the query, instead. Queries made only of exclusions, which $text
+// matches nothing for, match the posts without the excluded words or
+// phrases in their names, tags or descriptions.
+func searchFilter(query string) (bson.E, bool) {
+	query = strings.TrimSpace(query)
+	search := searchQuery{storage.ParseSearch(query)}
+	switch {
+	case utf8.RuneCountInString(query) < minTextSearchLength || search.Empty():
+		return prefixFilter(query), false
+	case len(search.Terms) == 0 && len(search.Phrases) == 0:
+		return exclusionFilter(search.Excluded), false
+	default:
+		return bson.E{Key: "$text", Value: bson.M{"$search": search.withVariants().String()}}, true
+	}
+}
+
+// prefixFilter returns the filter on names in which a word starts with the
+// literal query, or folded names in which a word starts with a variant of it.
+func prefixFilter(query string) bson.E {
+	variants := translit.Variants(query)
+	for i, variant := range variants {
+		variants[i] = regexp.QuoteMeta(variant)
+	}
+	return bson.E{Key: "$or", Value: bson.A{
+		bson.M{"name": bson.M{"$regex": wordStart + variants[0], "$options": "i"}},
+		bson.M{"name_translit": bson.M{"$regex": wordStart + "(?:" + strings.Join(variants, "|") + ")", "$options": "i"}},
+	}}
+}
+
+// exclusionFilter returns the filter on posts in whose names, tags and
+// descriptions none of the excluded words or phrases is found as whole
+// words, case-insensitively.
+func exclusionFilter(excluded []string) bson.E {
+	var conditions bson.A
+	for _, part := range excluded {
+		pattern := bson.M{"$regex": wordStart + regexp.QuoteMeta(part) + wordEnd, "$options": "i"}
+		for _, field := range []string{"name", "tags", "description"} {
+			conditions = append(conditions, bson.M{field: pattern})
+		}
+	}
+	return bson.E{Key: "$nor", Value: conditions}
+}
+
+// wordStart and wordEnd are regular expressions matching the start and the
+// end of a word.
+const (
+	wordStart = `(?:^|[^\p{L}\p{N}])`
+	wordEnd   = `(?:$|[^\p{L}\p{N}])`
+)
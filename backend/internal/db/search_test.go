@@ -0,0 +1,115 @@
+package db
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// regexMatches reports whether a $regex condition matches s, compiled with Go's
+// regular expressions, which agree with MongoDB's on the patterns used here.
+func regexMatches(t *testing.T, condition bson.M, s string) bool {
+	t.Helper()
+	pattern := condition["$regex"].(string)
+	if condition["$options"] == "i" {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.MustCompile(pattern).MatchString(s)
+}
+
+func TestSearchFilterText(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"golang", "golang pshdftp"},
+		{`go "concurrency patterns"`, `go "concurrency patterns"`},
+		{"rust -unsafe", "rust kge hie -unsafe"},
+		{`c++ -"hello world"`, `c++ -"hello world"`},
+	}
+
+	for _, tt := range tests {
+		condition, ranked := searchFilter(tt.query)
+		if condition.Key != "$text" || !ranked {
+			t.Errorf("searchFilter(%q) = %v, %v, want a ranked $text filter", tt.query, condition, ranked)
+			continue
+		}
+		if got := condition.Value.(bson.M)["$search"]; got != tt.want {
+			t.Errorf("searchFilter(%q): $search = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearchFilterPrefix(t *testing.T) {
+	tests := []struct {
+		query        string
+		name, folded string
+		want         bool
+	}{
+		{"go", "Learning Go", "learning go", true},
+		{"go", "Mongo", "mongo", false},
+		{"c+", "Programming in C++", "programming in c++", true},
+		{"(", "Learning Go", "learning go", false},
+		{".*", "Learning Go", "learning go", false},
+		{"pr", "Привет", "privet", true},
+	}
+
+	for _, tt := range tests {
+		condition, ranked := searchFilter(tt.query)
+		if condition.Key != "$or" || ranked {
+			t.Fatalf("searchFilter(%q) = %v, %v, want an unranked $or filter", tt.query, condition, ranked)
+		}
+		alternatives := condition.Value.(bson.A)
+		name := alternatives[0].(bson.M)["name"].(bson.M)
+		folded := alternatives[1].(bson.M)["name_translit"].(bson.M)
+		if got := regexMatches(t, name, tt.name) || regexMatches(t, folded, tt.folded); got != tt.want {
+			t.Errorf("searchFilter(%q) matches %q: %v, want %v", tt.query, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSearchFilterExclusionsOnly(t *testing.T) {
+	condition, ranked := searchFilter(`-go -"hello world"`)
+	if condition.Key != "$nor" || ranked {
+		t.Fatalf("searchFilter = %v, %v, want an unranked $nor filter", condition, ranked)
+	}
+
+	conditions := condition.Value.(bson.A)
+	if len(conditions) != 6 {
+		t.Fatalf("$nor has %d conditions, want one per excluded part and field", len(conditions))
+	}
+	word := conditions[0].(bson.M)["name"].(bson.M)
+	phrase := conditions[3].(bson.M)["name"].(bson.M)
+
+	tests := []struct {
+		pattern bson.M
+		text    string
+		want    bool
+	}{
+		{word, "Learning Go", true},
+		{word, "go-to guide", true},
+		{word, "Mongo", false},
+		{word, "Gopher", false},
+		{phrase, "Hello World in Go", true},
+		{phrase, "Hello, World", false},
+	}
+	for _, tt := range tests {
+		if got := regexMatches(t, tt.pattern, tt.text); got != tt.want {
+			t.Errorf("%v matches %q: %v, want %v", tt.pattern["$regex"], tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPostsFilterLanguage(t *testing.T) {
+	filter, _ := postsFilter("", "go", "", ".*", "")
+
+	if got := filter["tags"]; got != "go" {
+		t.Errorf("tags = %v, want go", got)
+	}
+	want := bson.M{"$eq": bson.A{bson.M{"$arrayElemAt": bson.A{"$tags", -1}}, ".*"}}
+	if got := filter["$expr"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("$expr = %v, want the literal language compared with the last tag", got)
+	}
+}
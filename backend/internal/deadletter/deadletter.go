@@ -0,0 +1,69 @@
+// Package deadletter defines the records kept for messages that could not make
+// it through the ingestion pipeline, so they can be inspected, fixed and
+// retried instead of being lost.
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+)
+
+// ErrNotFound is returned when a requested dead-letter entry does not exist.
+var ErrNotFound = errors.New("dead letter not found")
+
+// Stage identifies the pipeline step at which a message failed.
+type Stage string
+
+// Pipeline stages that can dead-letter a message.
+const (
+	StageProcess Stage = "process" // The message could not be parsed or validated
+	StageSave    Stage = "save"    // The processed message could not be persisted
+)
+
+// Entry is a dead-lettered message together with the details of its failure.
+// Failures of the same Telegram message share one entry, which records the
+// latest stage and error and counts the attempts.
+type Entry struct {
+	ID        string      `json:"id" bson:"_id"`                // Identifier derived from the chat and message IDs
+	Message   bot.Message `json:"message" bson:"message"`       // Raw message as received from Telegram
+	Stage     Stage       `json:"stage" bson:"stage"`           // Stage of the latest failure
+	Error     string      `json:"error" bson:"error"`           // Error of the latest failure
+	Attempts  int         `json:"attempts" bson:"attempts"`     // Number of times the message has failed
+	CreatedAt time.Time   `json:"created_at" bson:"created_at"` // Time of the first failure
+	UpdatedAt time.Time   `json:"updated_at" bson:"updated_at"` // Time of the latest failure
+}
+
+// Sink is implemented by dead-letter stores used by pipeline stages.
+type Sink interface {
+	// Record stores a failed message, or updates the entry of a message that failed before.
+	Record(ctx context.Context, msg bot.Message, stage Stage, err error) error
+	// Resolve removes the entry of a message once it has been stored successfully.
+	Resolve(ctx context.Context, chatID int64, messageID int) error
+}
+
+// Page is one page of dead-letter entries.
+type Page struct {
+	Entries    []Entry // Entries of the page, most recent failures first; never nil
+	TotalCount int64   // Number of entries on all pages
+}
+
+// Store is implemented by dead-letter stores, which the admin API uses to
+// inspect, retry and discard entries. Every storage backend provides one.
+type Store interface {
+	Sink
+	// List retrieves one page of entries, most recent failures first.
+	List(ctx context.Context, page, limit int) (Page, error)
+	// Get retrieves a single entry, or returns ErrNotFound.
+	Get(ctx context.Context, id string) (Entry, error)
+	// Delete discards an entry, or returns ErrNotFound.
+	Delete(ctx context.Context, id string) error
+}
+
+// EntryID returns the identifier of the entry for a Telegram message.
+func EntryID(chatID int64, messageID int) string {
+	return fmt.Sprintf("%d:%d", chatID, messageID)
+}
@@ -0,0 +1,151 @@
+// Package deadlettertest checks that implementations of deadletter.Store
+// behave alike, so that every storage backend can be tested the same way.
+package deadlettertest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+)
+
+// Run tests the dead-letter store returned by newStore, which must be empty.
+func Run(t *testing.T, newStore func(t *testing.T) deadletter.Store) {
+	t.Run("RecordAndGet", func(t *testing.T) { testRecordAndGet(t, newStore(t)) })
+	t.Run("List", func(t *testing.T) { testList(t, newStore(t)) })
+	t.Run("ResolveAndDelete", func(t *testing.T) { testResolveAndDelete(t, newStore(t)) })
+}
+
+// message returns a message that can be dead-lettered.
+func message(messageID int) bot.Message {
+	return bot.Message{
+		Library:   "books",
+		Text:      "Name: Learning Go",
+		URL:       "https://example.com/go",
+		Links:     []bot.Link{{URL: "https://example.com/go", Text: "Learning Go"}},
+		ChatID:    100,
+		MessageID: messageID,
+		Date:      time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func testRecordAndGet(t *testing.T, store deadletter.Store) {
+	ctx := context.Background()
+	msg := message(1)
+
+	if err := store.Record(ctx, msg, deadletter.StageProcess, errors.New("missing type")); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	first, err := store.Get(ctx, deadletter.EntryID(100, 1))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	msg.Text = "Name: Learning Go\nType: book"
+	if err := store.Record(ctx, msg, deadletter.StageSave, errors.New("connection refused")); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	entry, err := store.Get(ctx, deadletter.EntryID(100, 1))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	if entry.ID != "100:1" {
+		t.Errorf("ID = %q, want 100:1", entry.ID)
+	}
+	if entry.Message.Text != msg.Text || entry.Message.URL != msg.URL || !slices.Equal(entry.Message.Links, msg.Links) || !entry.Message.Date.Equal(msg.Date) {
+		t.Errorf("Message = %+v, want %+v", entry.Message, msg)
+	}
+	if entry.Stage != deadletter.StageSave || entry.Error != "connection refused" {
+		t.Errorf("Stage, Error = %q, %q, want the latest failure", entry.Stage, entry.Error)
+	}
+	if entry.Attempts != 2 {
+		t.Errorf("Attempts = %d, want 2", entry.Attempts)
+	}
+	if !entry.CreatedAt.Equal(first.CreatedAt) || entry.UpdatedAt.Before(first.UpdatedAt) {
+		t.Errorf("CreatedAt, UpdatedAt = %v, %v after %v, %v", entry.CreatedAt, entry.UpdatedAt, first.CreatedAt, first.UpdatedAt)
+	}
+
+	if _, err := store.Get(ctx, "100:2"); !errors.Is(err, deadletter.ErrNotFound) {
+		t.Errorf("Get of a missing entry: error = %v, want %v", err, deadletter.ErrNotFound)
+	}
+}
+
+func testList(t *testing.T, store deadletter.Store) {
+	ctx := context.Background()
+
+	page, err := store.List(ctx, 1, 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if page.Entries == nil || len(page.Entries) != 0 || page.TotalCount != 0 {
+		t.Errorf("List of an empty store = %+v, want no entries", page)
+	}
+
+	for id := 1; id <= 3; id++ {
+		if err := store.Record(ctx, message(id), deadletter.StageProcess, errors.New("failed")); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+		// Entries are ordered by the time of their latest failure
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	tests := []struct {
+		page, limit int
+		want        []string
+	}{
+		{1, 2, []string{"100:3", "100:2"}},
+		{2, 2, []string{"100:1"}},
+		{3, 2, []string{}},
+	}
+	for _, tt := range tests {
+		page, err := store.List(ctx, tt.page, tt.limit)
+		if err != nil {
+			t.Fatalf("List(%d, %d): %v", tt.page, tt.limit, err)
+		}
+		ids := []string{}
+		for _, entry := range page.Entries {
+			ids = append(ids, entry.ID)
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("List(%d, %d) = %v, want %v", tt.page, tt.limit, ids, tt.want)
+		}
+		if page.TotalCount != 3 {
+			t.Errorf("List(%d, %d): TotalCount = %d, want 3", tt.page, tt.limit, page.TotalCount)
+		}
+	}
+}
+
+func testResolveAndDelete(t *testing.T, store deadletter.Store) {
+	ctx := context.Background()
+	for id := 1; id <= 2; id++ {
+		if err := store.Record(ctx, message(id), deadletter.StageSave, errors.New("failed")); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+
+	if err := store.Resolve(ctx, 100, 1); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if _, err := store.Get(ctx, "100:1"); !errors.Is(err, deadletter.ErrNotFound) {
+		t.Errorf("Get of a resolved entry: error = %v, want %v", err, deadletter.ErrNotFound)
+	}
+	if err := store.Resolve(ctx, 100, 1); err != nil {
+		t.Errorf("Resolve of a missing entry: %v", err)
+	}
+
+	if err := store.Delete(ctx, "100:2"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := store.Delete(ctx, "100:2"); !errors.Is(err, deadletter.ErrNotFound) {
+		t.Errorf("Delete of a missing entry: error = %v, want %v", err, deadletter.ErrNotFound)
+	}
+
+	if page, err := store.List(ctx, 1, 10); err != nil || page.TotalCount != 0 {
+		t.Errorf("List = %+v, %v, want no entries", page, err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package logging configures structured JSON logging with log/slog and
+// carries correlation IDs through contexts, so that every log record about
+// one Telegram post or one HTTP request can be found by a single ID.
+// Records logged while a span is active also carry its trace and span IDs.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CorrelationIDKey is the attribute under which correlation IDs are logged.
+const CorrelationIDKey = "correlation_id"
+
+// correlationIDKey is the context key of the correlation ID.
+type correlationIDKey struct{}
+
+// Setup installs a JSON logger writing to w as the default slog logger,
+// which also receives the output of the standard log package.
+// level is one of "debug", "info", "warn" or "error"; an empty value selects "info".
+// Returns an error if the level is unknown.
+func Setup(w io.Writer, level string) error {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(strings.ToLower(level))); err != nil {
+			return fmt.Errorf("invalid log level %q: %w", level, err)
+		}
+	}
+
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: lvl})
+	slog.SetDefault(slog.New(&correlationHandler{Handler: handler}))
+	return nil
+}
+
+// NewID returns a new random correlation ID.
+func NewID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// WithCorrelationID returns a copy of ctx carrying the correlation ID.
+// An empty ID leaves ctx unchanged.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns the correlation ID carried by ctx, or an empty string.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// correlationHandler adds the correlation ID and the trace and span IDs of the
+// context passed to the logging call, if any, to every record.
+type correlationHandler struct {
+	slog.Handler
+}
+
+// Handle implements slog.Handler.
+func (h *correlationHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := CorrelationID(ctx); id != "" {
+		record.AddAttrs(slog.String(CorrelationIDKey, id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *correlationHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &correlationHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler.
+func (h *correlationHandler) WithGroup(name string) slog.Handler {
+	return &correlationHandler{Handler: h.Handler.WithGroup(name)}
+}
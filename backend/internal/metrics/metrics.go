@@ -0,0 +1,91 @@
+// Package metrics defines the Prometheus metrics of the service. The metrics
+// are registered with the default registry, which is exposed at /metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// namespace prefixes the names of all metrics of the service.
+const namespace = "kirinyoku"
+
+var (
+	// BotUpdates counts channel posts received from Telegram by kind
+	// ("new" or "edited") and outcome ("queued", "ignored", "empty" or "failed").
+	BotUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "bot",
+		Name:      "updates_total",
+		Help:      "Channel posts received from Telegram, by kind and outcome.",
+	}, []string{"kind", "outcome"})
+
+	// ProcessedMessages counts messages handled by the processor by outcome
+	// ("processed" or "rejected") and, for rejected messages, the reason,
+	// which is the name of the invalid field.
+	ProcessedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "messages_total",
+		Help:      "Messages handled by the processor, by outcome and rejection reason.",
+	}, []string{"outcome", "reason"})
+
+	// DBWriteDuration observes the latency of saving messages to the post store,
+	// by result ("success" or "error").
+	DBWriteDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "write_duration_seconds",
+		Help:      "Latency of saving messages to the post store, by result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+
+	// DBWriteFailures counts failed attempts to save a message to the post store.
+	DBWriteFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "write_failures_total",
+		Help:      "Failed attempts to save a message to the post store.",
+	})
+
+	// HTTPRequestDuration observes the latency of API requests by method,
+	// route pattern and status code.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of API requests, by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// PostFilters counts /posts requests using each filter
+	// ("search", "tag", "type", "language" or "library").
+	PostFilters = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "api",
+		Name:      "post_filters_total",
+		Help:      "Requests for posts using each filter.",
+	}, []string{"filter"})
+)
+
+// RegisterQueue exposes the depth and capacity of a pipeline queue under the
+// given name. depth and capacity are called on every scrape.
+func RegisterQueue(name string, depth, capacity func() int) {
+	labels := prometheus.Labels{"queue": name}
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   "queue",
+		Name:        "depth",
+		Help:        "Unacknowledged items in a pipeline queue.",
+		ConstLabels: labels,
+	}, func() float64 { return float64(depth()) })
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   "queue",
+		Name:        "capacity",
+		Help:        "Maximum number of unacknowledged items in a pipeline queue.",
+		ConstLabels: labels,
+	}, func() float64 { return float64(capacity()) })
+}
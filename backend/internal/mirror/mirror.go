@@ -0,0 +1,95 @@
+// Package mirror provides functionality for copying files attached to channel
+// posts into blob storage. Telegram file links expire and require the bot
+// token, so mirrored copies are what the API serves to website visitors.
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/blob"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// tracer creates the spans of mirrored attachments.
+var tracer = otel.Tracer("github.com/kirinyoku/kirinyoku-space-web/backend/internal/mirror")
+
+// Fetcher downloads Telegram files by their file ID.
+type Fetcher interface {
+	FetchFile(ctx context.Context, fileID string) (io.ReadCloser, error)
+}
+
+// Mirror downloads attachments with a Fetcher and stores them in a blob store.
+type Mirror struct {
+	fetcher Fetcher    // Source of attachment content
+	store   blob.Store // Destination for mirrored files
+}
+
+// New creates a Mirror that copies files from fetcher into store.
+// Returns an error if either dependency is nil.
+func New(fetcher Fetcher, store blob.Store) (*Mirror, error) {
+	if fetcher == nil || store == nil {
+		return nil, fmt.Errorf("fetcher and store cannot be nil")
+	}
+
+	return &Mirror{
+		fetcher: fetcher,
+		store:   store,
+	}, nil
+}
+
+// Key returns the blob key under which the attachment of a post is stored.
+// It includes the file's unique ID, so replacing the file of an edited post
+// produces a new key while re-saving an unchanged post reuses the stored copy.
+func Key(chatID int64, messageID int, fileUniqueID string) string {
+	return fmt.Sprintf("%d/%d/%s", chatID, messageID, fileUniqueID)
+}
+
+// Mirror copies the attachment of the message into blob storage, unless it
+// is already stored, and records the blob key on the attachment.
+// Messages without an attachment, or with one that cannot be downloaded
+// through the Bot API (such as imported posts), are left unchanged.
+// Uses a timeout context derived from ctx to prevent hanging downloads.
+func (m *Mirror) Mirror(ctx context.Context, message *processor.ProcessedMessage) (err error) {
+	attachment := message.Attachment
+	if attachment == nil || attachment.FileID == "" || attachment.FileUniqueID == "" {
+		return nil
+	}
+
+	ctx, span := tracer.Start(ctx, "mirror.attachment")
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	key := Key(message.ChatID, message.MessageID, attachment.FileUniqueID)
+
+	exists, err := m.store.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.String("blob.key", key), attribute.Bool("blob.exists", exists))
+
+	if !exists {
+		content, err := m.fetcher.FetchFile(ctx, attachment.FileID)
+		if err != nil {
+			return err
+		}
+		defer content.Close()
+
+		if err := m.store.Put(ctx, key, content); err != nil {
+			return err
+		}
+
+		slog.InfoContext(ctx, "Mirrored attachment", "kind", attachment.Kind, "chat_id", message.ChatID, "message_id", message.MessageID, "key", key)
+	}
+
+	attachment.BlobKey = key
+	return nil
+}
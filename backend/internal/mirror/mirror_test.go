@@ -0,0 +1,144 @@
+package mirror_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/blob"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot/bottest"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/mirror"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/queue"
+)
+
+func init() {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// newMirror returns a mirror downloading files from a stand-in Bot API
+// server into a blob store in a temporary directory.
+func newMirror(t *testing.T) (*mirror.Mirror, *bottest.Server, blob.Store) {
+	t.Helper()
+	server := bottest.NewServer(t)
+
+	q, err := queue.Open[bot.Message](filepath.Join(t.TempDir(), "messages.log"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+	b, err := bot.New(bottest.Token, server.URL, map[int64]string{-100: "books"}, q)
+	if err != nil {
+		t.Fatalf("bot.New: %v", err)
+	}
+
+	store, err := blob.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := mirror.New(b, store)
+	if err != nil {
+		t.Fatalf("mirror.New: %v", err)
+	}
+	return m, server, store
+}
+
+// newMessage returns a processed message with a document attachment.
+func newMessage(fileID string) processor.ProcessedMessage {
+	return processor.ProcessedMessage{
+		ChatID:    -100,
+		MessageID: 7,
+		Attachment: &processor.Attachment{
+			Kind:         bot.AttachmentDocument,
+			FileID:       fileID,
+			FileUniqueID: "unique-" + fileID,
+			FileName:     "book.pdf",
+		},
+	}
+}
+
+func TestMirror(t *testing.T) {
+	m, server, store := newMirror(t)
+	server.AddFile("doc", []byte("%PDF-1.7"))
+
+	message := newMessage("doc")
+	if err := m.Mirror(context.Background(), &message); err != nil {
+		t.Fatalf("Mirror: %v", err)
+	}
+
+	want := mirror.Key(-100, 7, "unique-doc")
+	if message.Attachment.BlobKey != want {
+		t.Errorf("BlobKey = %q, want %q", message.Attachment.BlobKey, want)
+	}
+	object, err := store.Open(context.Background(), want)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, err := io.ReadAll(object)
+	object.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "%PDF-1.7" {
+		t.Errorf("stored content = %q, want the downloaded file", data)
+	}
+
+	// A stored attachment is not downloaded again
+	again := newMessage("doc")
+	if err := m.Mirror(context.Background(), &again); err != nil {
+		t.Fatalf("Mirror: %v", err)
+	}
+	if again.Attachment.BlobKey != want {
+		t.Errorf("BlobKey = %q, want %q", again.Attachment.BlobKey, want)
+	}
+	if n := server.Downloads(); n != 1 {
+		t.Errorf("downloads = %d, want 1", n)
+	}
+}
+
+func TestMirrorFailedDownload(t *testing.T) {
+	m, server, store := newMirror(t)
+	server.AddFile("expired", nil)
+
+	for _, fileID := range []string{"expired", "unknown"} {
+		message := newMessage(fileID)
+		if err := m.Mirror(context.Background(), &message); err == nil {
+			t.Errorf("Mirror of %q succeeded, want an error", fileID)
+		}
+		if message.Attachment.BlobKey != "" {
+			t.Errorf("BlobKey = %q, want none", message.Attachment.BlobKey)
+		}
+
+		key := mirror.Key(-100, 7, "unique-"+fileID)
+		if exists, err := store.Exists(context.Background(), key); err != nil || exists {
+			t.Errorf("Exists(%q) = %v, %v, want false", key, exists, err)
+		}
+	}
+}
+
+func TestMirrorSkipsMessagesWithoutFiles(t *testing.T) {
+	m, server, _ := newMirror(t)
+
+	imported := newMessage("")
+	for _, message := range []processor.ProcessedMessage{{ChatID: -100, MessageID: 1}, imported} {
+		if err := m.Mirror(context.Background(), &message); err != nil {
+			t.Errorf("Mirror: %v", err)
+		}
+		if message.Attachment != nil && message.Attachment.BlobKey != "" {
+			t.Errorf("BlobKey = %q, want none", message.Attachment.BlobKey)
+		}
+	}
+	if n := server.Downloads(); n != 0 {
+		t.Errorf("downloads = %d, want 0", n)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := mirror.New(nil, nil); err == nil {
+		t.Error("New without dependencies succeeded, want an error")
+	}
+}
@@ -4,70 +4,279 @@
 package processor
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/logging"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/metrics"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/queue"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/supervisor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracer creates the spans of processed messages.
+var tracer = otel.Tracer("github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor")
+
 // ProcessedMessage represents a fully processed message ready for storage or further handling.
 // It contains structured data extracted from the original message text.
 type ProcessedMessage struct {
-	Name string   `json:"name"` // The name or title of the resource
-	Type string   `json:"type"` // The type or category of the resource
-	Tags []string `json:"tags"` // List of tags associated with the resource
-	URL  string   `json:"url"`  // URL linking to the resource
+	Library     string      `json:"library" bson:"library"`                             // Library the resource belongs to
+	Name        string      `json:"name"`                                               // The name or title of the resource
+	Type        string      `json:"type"`                                               // The type or category of the resource
+	Description string      `json:"description,omitempty" bson:"description,omitempty"` // Optional summary of the resource
+	Tags        []string    `json:"tags"`                                               // List of tags associated with the resource
+	URL         string      `json:"url"`                                                // Primary URL linking to the resource
+	Links       []Link      `json:"links" bson:"links"`                                 // All links in the post, e.g. mirrors or companion resources
+	ChatID      int64       `json:"chat_id" bson:"chat_id"`                             // Telegram channel the resource was posted in
+	MessageID   int         `json:"message_id" bson:"message_id"`                       // Telegram message the resource was posted in
+	Timestamp   time.Time   `json:"timestamp" bson:"timestamp"`                         // Time the resource was posted on Telegram
+	IngestedAt  time.Time   `json:"ingested_at" bson:"ingested_at"`                     // Time the resource was first stored
+	Attachment  *Attachment `json:"attachment,omitempty" bson:"attachment,omitempty"`   // File shared with the resource
+	Source      bot.Message `json:"-" bson:"-"`                                         // Raw message the resource was parsed from
+}
+
+// Link is a URL mentioned in a post together with its anchor text.
+type Link struct {
+	URL  string `json:"url" bson:"url"`   // Target of the link
+	Text string `json:"text" bson:"text"` // Visible anchor text
+}
+
+// Attachment describes a file (document, photo, etc.) posted together with a resource.
+type Attachment struct {
+	Kind         string `json:"kind" bson:"kind"`                               // Kind of attachment, e.g. "document" or "photo"
+	FileID       string `json:"file_id" bson:"file_id"`                         // Telegram file identifier
+	FileUniqueID string `json:"file_unique_id" bson:"file_unique_id"`           // Telegram identifier that stays the same for the same file
+	FileName     string `json:"file_name,omitempty" bson:"file_name,omitempty"` // Original file name
+	MIMEType     string `json:"mime_type,omitempty" bson:"mime_type,omitempty"` // MIME type of the file
+	Size         int64  `json:"size,omitempty" bson:"size,omitempty"`           // File size in bytes
+	BlobKey      string `json:"blob_key,omitempty" bson:"blob_key,omitempty"`   // Key of the mirrored copy in blob storage
+}
+
+// ValidationError describes why a message could not be turned into a resource.
+// Field names the offending field ("name", "type", "tags" or "url") and
+// Problem explains what is wrong with it.
+type ValidationError struct {
+	Field   string
+	Problem string
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid field %q: %s", e.Field, e.Problem)
+}
+
+// Reporter is notified about messages that fail processing, so that their
+// authors can be told why a post did not make it to the library.
+type Reporter interface {
+	ReportFailure(msg bot.Message, err error)
 }
 
 // Processor handles the transformation of raw bot messages into structured data.
-// It operates asynchronously using channels for input and output communication.
+// It operates asynchronously using durable queues for input and output communication.
 type Processor struct {
-	inputChan  chan bot.Message      // Channel for receiving raw messages
-	outputChan chan ProcessedMessage // Channel for sending processed messages
+	input      *queue.Queue[bot.Message]      // Queue of raw messages
+	output     *queue.Queue[ProcessedMessage] // Queue of processed messages
+	reporter   Reporter                       // Optional receiver of processing failures
+	deadLetter deadletter.Sink                // Optional store for messages that could not be processed
+	drain      context.CancelFunc             // Ends the loop once the input queue is empty
+	abort      context.CancelFunc             // Ends the loop without waiting for the output queue
+	stopped    chan struct{}                  // Closed when the loop has ended
 }
 
-// NewProcessor creates and initializes a new Processor with the specified input and output channels.
-// Returns an error if either channel is nil.
-func NewProcessor(inputChan chan bot.Message, outputChan chan ProcessedMessage) (*Processor, error) {
-	if inputChan == nil || outputChan == nil {
-		return nil, fmt.Errorf("input and output channels cannot be nil")
+// NewProcessor creates and initializes a new Processor with the specified input and output queues.
+// Returns an error if either queue is nil.
+func NewProcessor(input *queue.Queue[bot.Message], output *queue.Queue[ProcessedMessage]) (*Processor, error) {
+	if input == nil || output == nil {
+		return nil, fmt.Errorf("input and output queues cannot be nil")
 	}
 
 	return &Processor{
-		inputChan:  inputChan,
-		outputChan: outputChan,
+		input:  input,
+		output: output,
 	}, nil
 }
 
-// Start begins the message processing loop in a separate goroutine.
-// It continuously reads from the input channel, processes each message,
-// and sends the results to the output channel.
-func (p *Processor) Start() {
+// SetReporter sets the receiver of processing failures. It must be called before Start.
+func (p *Processor) SetReporter(r Reporter) {
+	p.reporter = r
+}
+
+// SetDeadLetters sets the store for messages that fail processing.
+// It must be called before Start.
+func (p *Processor) SetDeadLetters(sink deadletter.Sink) {
+	p.deadLetter = sink
+}
+
+// Start begins the message processing loop in a separate goroutine,
+// supervised by the given component, which restarts the loop if it fails
+// and records the time of every handled message.
+// The loop continuously takes messages from the input queue, processes each one,
+// and appends the results to the output queue. A message is acknowledged
+// only after its result is queued, so it is processed again if the loop or
+// the service stops in between; while the output queue is full, processing
+// waits.
+// Messages that fail processing are skipped and passed to the reporter,
+// if one is set, and recorded as dead letters, if a store is set.
+// The loop runs until Stop is called or the input queue is closed.
+func (p *Processor) Start(component *supervisor.Component) {
+	draining, drain := context.WithCancel(context.Background())
+	aborting, abort := context.WithCancel(context.Background())
+	p.drain, p.abort = drain, abort
+	p.stopped = make(chan struct{})
+
 	go func() {
-		for msg := range p.inputChan {
-			processed, err := p.processMessage(msg)
-			if err != nil {
-				log.Printf("Skipping message due to processing error: %v", err)
-				continue
-			}
+		defer close(p.stopped)
+		component.Run(aborting, func() error {
+			return p.run(draining, aborting, component)
+		})
+	}()
+
+	slog.Info("Processor started")
+}
 
-			select {
-			case p.outputChan <- *processed:
-				log.Printf("Processed message: %+v", processed)
-			default:
-				log.Printf("Output channel full, skipping message: %s", processed.Name)
+// run is the processing loop. It starts with the oldest unacknowledged
+// message and returns nil once draining is done and the input queue is
+// empty, or when the input queue is closed, and an error if the queues
+// cannot be written.
+func (p *Processor) run(draining, aborting context.Context, component *supervisor.Component) error {
+	// Deliver again the messages left unacknowledged by a failed run
+	p.input.Rewind()
+
+	for {
+		// Once draining, Get only fails when no queued message is left
+		item, err := p.input.Get(draining)
+		if errors.Is(err, queue.ErrClosed) || errors.Is(err, context.Canceled) {
+			return nil
+		}
+		if err != nil {
+			slog.Error("Failed to take message from queue", "error", err)
+			continue
+		}
+
+		msg := item.Value
+		ctx := logging.WithCorrelationID(tracing.Extract(aborting, msg.TraceContext), msg.CorrelationID)
+		if err := p.handle(ctx, msg); err != nil {
+			// Leave the message unacknowledged, so that the restarted loop
+			// processes it again
+			if aborting.Err() != nil || errors.Is(err, queue.ErrClosed) {
+				return nil
 			}
+			return err
 		}
-	}()
 
-	log.Printf("Processor started")
+		if err := p.input.Ack(item.Seq); err != nil {
+			return fmt.Errorf("failed to acknowledge message %d: %w", msg.MessageID, err)
+		}
+		component.Beat()
+	}
+}
+
+// handle processes a message and queues the result. A message that cannot be
+// processed is reported and recorded as a dead letter instead.
+// Returns an error if the result could not be queued.
+func (p *Processor) handle(ctx context.Context, msg bot.Message) (err error) {
+	ctx, span := tracer.Start(ctx, "processor.process", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(
+		attribute.Int64("telegram.chat_id", msg.ChatID),
+		attribute.Int("telegram.message_id", msg.MessageID),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	processed, err := processMessage(msg)
+	if err != nil {
+		slog.WarnContext(ctx, "Skipping message due to processing error", "chat_id", msg.ChatID, "message_id", msg.MessageID, "error", err)
+		reason := rejectionReason(err)
+		metrics.ProcessedMessages.WithLabelValues("rejected", reason).Inc()
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("outcome", "rejected"), attribute.String("reason", reason))
+		if p.reporter != nil {
+			p.reporter.ReportFailure(msg, err)
+		}
+		p.recordDeadLetter(ctx, msg, deadletter.StageProcess, err)
+		return nil
+	}
+
+	// The database writer continues the trace of the message
+	processed.Source.TraceContext = tracing.Inject(ctx)
+	if err := p.output.Put(ctx, *processed); err != nil {
+		return fmt.Errorf("failed to queue processed message %d: %w", msg.MessageID, err)
+	}
+
+	slog.InfoContext(ctx, "Processed message",
+		"library", processed.Library,
+		"chat_id", processed.ChatID,
+		"message_id", processed.MessageID,
+		"name", processed.Name,
+		"type", processed.Type,
+		"tags", processed.Tags,
+	)
+	metrics.ProcessedMessages.WithLabelValues("processed", "").Inc()
+	span.SetAttributes(attribute.String("outcome", "processed"))
+	return nil
+}
+
+// Stop ends the processing loop once every message in the input queue has
+// been processed, waiting until the loop finishes. If ctx is done first,
+// the loop is abandoned without waiting for room in the output queue and
+// ctx.Err() is returned; unfinished messages stay in the input queue.
+// It must only be called after Start.
+func (p *Processor) Stop(ctx context.Context) error {
+	p.drain()
+
+	select {
+	case <-p.stopped:
+		p.abort()
+		slog.Info("Processor stopped")
+		return nil
+	case <-ctx.Done():
+		p.abort()
+		return ctx.Err()
+	}
+}
+
+// rejectionReason returns the metrics label for a processing error:
+// the invalid field of a validation error, or "other".
+func rejectionReason(err error) string {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Field
+	}
+	return "other"
+}
+
+// recordDeadLetter stores a failed message in the dead-letter store, if one is set.
+func (p *Processor) recordDeadLetter(ctx context.Context, msg bot.Message, stage deadletter.Stage, err error) {
+	if p.deadLetter == nil {
+		return
+	}
+
+	if err := p.deadLetter.Record(ctx, msg, stage, err); err != nil {
+		slog.ErrorContext(ctx, "Failed to record dead letter", "chat_id", msg.ChatID, "message_id", msg.MessageID, "error", err)
+	}
+}
+
+// Process transforms a single raw message synchronously, without a Processor
+// and its queues. It is used by one-off jobs such as imports, where every
+// message must be handled before the job exits.
+func Process(msg bot.Message) (*ProcessedMessage, error) {
+	return processMessage(msg)
 }
 
 // processMessage transforms a raw bot message into a structured ProcessedMessage.
 // It parses the message text line by line, extracting key-value pairs and validating
-// that all required fields are present. It also ensures the message contains a valid URL.
-func (p *Processor) processMessage(msg bot.Message) (*ProcessedMessage, error) {
+// that all required fields are present. It also ensures the message contains a valid URL,
+// unless the resource itself is attached to the message as a file. An optional
+// "Description" field is kept as a summary of the resource.
+// Validation failures are returned as *ValidationError.
+func processMessage(msg bot.Message) (*ProcessedMessage, error) {
 	lines := strings.Split(msg.Text, "\n")
 	fields := make(map[string]string)
 
@@ -92,28 +301,63 @@ func (p *Processor) processMessage(msg bot.Message) (*ProcessedMessage, error) {
 	requiredFields := []string{"name", "type", "tags"}
 	for _, field := range requiredFields {
 		if value, ok := fields[field]; !ok || strings.TrimSpace(value) == "" {
-			return nil, fmt.Errorf("missing or empty required field: %s", field)
+			return nil, &ValidationError{Field: field, Problem: "missing or empty required field"}
 		}
 	}
 
 	// Use the URL from the bot's Message struct
-	if msg.URL == "" {
-		return nil, fmt.Errorf("no valid URL found in message")
+	if msg.URL == "" && msg.Attachment == nil {
+		return nil, &ValidationError{Field: "url", Problem: "no valid URL or attachment found in message"}
 	}
 
 	tags := parseTags(fields["tags"])
 	if len(tags) == 0 {
-		return nil, fmt.Errorf("no valid tags found after parsing")
+		return nil, &ValidationError{Field: "tags", Problem: "no valid tags found after parsing"}
 	}
 
 	return &ProcessedMessage{
-		Name: fields["name"],
-		Type: fields["type"],
-		Tags: tags,
-		URL:  msg.URL,
+		Library:     msg.Library,
+		Name:        fields["name"],
+		Type:        fields["type"],
+		Description: fields["description"],
+		Tags:        tags,
+		URL:         msg.URL,
+		Links:       convertLinks(msg.Links),
+		ChatID:      msg.ChatID,
+		MessageID:   msg.MessageID,
+		Timestamp:   msg.Date,
+		Attachment:  convertAttachment(msg.Attachment),
+		Source:      msg,
 	}, nil
 }
 
+// convertLinks copies the links of a raw message.
+// Returns an empty slice if the message has no links.
+func convertLinks(links []bot.Link) []Link {
+	result := make([]Link, 0, len(links))
+	for _, link := range links {
+		result = append(result, Link{URL: link.URL, Text: link.Text})
+	}
+	return result
+}
+
+// convertAttachment copies the attachment metadata of a raw message.
+// Returns nil if the message has no attachment.
+func convertAttachment(attachment *bot.Attachment) *Attachment {
+	if attachment == nil {
+		return nil
+	}
+
+	return &Attachment{
+		Kind:         attachment.Kind,
+		FileID:       attachment.FileID,
+		FileUniqueID: attachment.FileUniqueID,
+		FileName:     attachment.FileName,
+		MIMEType:     attachment.MIMEType,
+		Size:         attachment.Size,
+	}
+}
+
 // parseTags converts a raw tags string into a clean slice of individual tags.
 // It handles various separator formats (spaces, commas, etc.), removes any
 // leading '#' symbols, and filters out empty tags. Returns nil if the input
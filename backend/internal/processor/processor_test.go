@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/queue"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/supervisor"
+)
+
+func init() {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// recorded is a call of fakeSink.Record.
+type recorded struct {
+	msg   bot.Message
+	stage deadletter.Stage
+	err   error
+}
+
+// fakeSink is a deadletter.Sink that remembers its calls.
+type fakeSink struct {
+	mu       sync.Mutex
+	recorded []recorded // Calls of Record in order
+	resolved []string   // Entry IDs passed to Resolve in order
+}
+
+func (s *fakeSink) Record(ctx context.Context, msg bot.Message, stage deadletter.Stage, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recorded = append(s.recorded, recorded{msg, stage, err})
+	return nil
+}
+
+func (s *fakeSink) Resolve(ctx context.Context, chatID int64, messageID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resolved = append(s.resolved, deadletter.EntryID(chatID, messageID))
+	return nil
+}
+
+// openQueue opens a queue at path, failing the test on error.
+func openQueue[T any](t *testing.T, path string) *queue.Queue[T] {
+	t.Helper()
+	q, err := queue.Open[T](path, 10)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestInvalidMessageIsDeadLettered(t *testing.T) {
+	dir := t.TempDir()
+	input := openQueue[bot.Message](t, filepath.Join(dir, "messages.log"))
+	output := openQueue[ProcessedMessage](t, filepath.Join(dir, "processed.log"))
+
+	p, err := NewProcessor(input, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &fakeSink{}
+	p.SetDeadLetters(sink)
+
+	invalid := bot.Message{ChatID: -100, MessageID: 1, Text: "Name: Learning Go\nTags: #go", URL: "https://go.dev"}
+	valid := bot.Message{ChatID: -100, MessageID: 2, Text: "Name: Learning Go\nType: book\nTags: #go", URL: "https://go.dev"}
+	for _, msg := range []bot.Message{invalid, valid} {
+		if err := input.Put(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p.Start(supervisor.New().Add("processor"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	if len(sink.recorded) != 1 {
+		t.Fatalf("Record was called %d times, want once for the invalid message", len(sink.recorded))
+	}
+	got := sink.recorded[0]
+	if got.msg.MessageID != invalid.MessageID || got.stage != deadletter.StageProcess {
+		t.Errorf("Record(message %d, %q), want message %d at %q", got.msg.MessageID, got.stage, invalid.MessageID, deadletter.StageProcess)
+	}
+	var validationErr *ValidationError
+	if !errors.As(got.err, &validationErr) || validationErr.Field != "type" {
+		t.Errorf("recorded error = %v, want a ValidationError of the type field", got.err)
+	}
+	if len(sink.resolved) != 0 {
+		t.Errorf("Resolve was called for %v, want no calls", sink.resolved)
+	}
+
+	// Both messages are acknowledged, and only the valid one is queued
+	if n := input.Len(); n != 0 {
+		t.Errorf("input queue has %d messages, want 0", n)
+	}
+	if n := output.Len(); n != 1 {
+		t.Fatalf("output queue has %d messages, want 1", n)
+	}
+	item, err := output.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Value.MessageID != valid.MessageID {
+		t.Errorf("queued message %d, want %d", item.Value.MessageID, valid.MessageID)
+	}
+}
+
+func TestStopDrainsQueue(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "messages.log")
+	input := openQueue[bot.Message](t, inputPath)
+	output := openQueue[ProcessedMessage](t, filepath.Join(dir, "processed.log"))
+	for id := 1; id <= 5; id++ {
+		msg := bot.Message{ChatID: -100, MessageID: id, Text: "Name: Learning Go\nType: book\nTags: #go", URL: "https://go.dev"}
+		if err := input.Put(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := NewProcessor(input, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start(supervisor.New().Add("processor"))
+
+	// Stop is called while the messages are still queued
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	if n := output.Len(); n != 5 {
+		t.Fatalf("output queue has %d messages, want 5", n)
+	}
+	for id := 1; id <= 5; id++ {
+		item, err := output.Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Value.MessageID != id {
+			t.Errorf("queued message %d, want %d", item.Value.MessageID, id)
+		}
+	}
+
+	// Every message was acknowledged, so none is processed again after a restart
+	input.Close()
+	input = openQueue[bot.Message](t, inputPath)
+	if n := input.Len(); n != 0 {
+		t.Errorf("reopened input queue has %d messages, want 0", n)
+	}
+}
@@ -0,0 +1,480 @@
+// Package queue provides a durable FIFO queue backed by an append-only log file.
+// It connects the stages of the ingestion pipeline: every item is written to
+// disk before Put returns and stays in the log until the consumer acknowledges
+// it, so items that were queued or being handled when the process stopped are
+// delivered again after a restart.
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// ErrClosed is returned by operations on a closed queue.
+var ErrClosed = errors.New("queue closed")
+
+// Record operations stored in the log.
+const (
+	opPut byte = 1 // An item was appended
+	opAck byte = 2 // An item was acknowledged and can be discarded
+)
+
+// headerSize is the size of a record header: operation, sequence number,
+// payload length and CRC-32 checksum of the payload.
+const headerSize = 1 + 8 + 4 + 4
+
+// maxPayloadSize bounds the payload length read from a record header,
+// so that a corrupt header cannot cause a huge allocation.
+const maxPayloadSize = 16 << 20
+
+// compactThreshold is the number of acknowledged records after which the log
+// is rewritten to contain only pending items.
+const compactThreshold = 1000
+
+// Item is a queued value together with the sequence number used to acknowledge it.
+type Item[T any] struct {
+	Seq   uint64 // Position of the item in the queue
+	Value T      // Queued value
+}
+
+// Queue is a durable, bounded FIFO queue of values of type T.
+// Values are gob-encoded, so all their exported fields are persisted.
+// Delivery is at-least-once: an item is handed out by Get once and removed
+// only by Ack; unacknowledged items are redelivered after Rewind or after the
+// queue is reopened.
+type Queue[T any] struct {
+	mu       sync.Mutex
+	path     string            // Path of the log file
+	file     *os.File          // Log file opened for appending
+	capacity int               // Maximum number of unacknowledged items
+	pending  map[uint64][]byte // Encoded values of unacknowledged items
+	next     uint64            // Sequence number of the next undelivered item
+	last     uint64            // Sequence number of the most recently appended item
+	acked    int               // Acknowledged records in the log since the last compaction
+	changed  chan struct{}     // Closed and replaced whenever the queue changes state
+	failed   error             // Why the log can no longer be written, nil while it can
+	closed   bool
+}
+
+// Open opens the queue stored in the log file at path, creating the file and
+// its directory if needed, and loads the items that were not acknowledged.
+// A record torn by a crash at the end of the log is discarded.
+// capacity bounds the number of unacknowledged items; Put blocks while it is reached.
+// Returns an error if the log cannot be read or rewritten.
+func Open[T any](path string, capacity int) (*Queue[T], error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("queue capacity must be positive")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+
+	q := &Queue[T]{
+		path:     path,
+		capacity: capacity,
+		pending:  make(map[uint64][]byte),
+		changed:  make(chan struct{}),
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	// Start from a compact log, which also drops any torn record at its end
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+
+	if len(q.pending) > 0 {
+		slog.Info("Replaying unacknowledged queue items", "queue", path, "items", len(q.pending))
+	}
+
+	return q, nil
+}
+
+// load replays the log file into the set of pending items.
+func (q *Queue[T]) load() error {
+	file, err := os.Open(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open queue log: %w", err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	for {
+		op, seq, payload, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			slog.Warn("Discarding the rest of the queue log", "queue", q.path, "error", err)
+			break
+		}
+
+		switch op {
+		case opPut:
+			q.pending[seq] = payload
+		case opAck:
+			delete(q.pending, seq)
+		}
+		q.last = max(q.last, seq)
+	}
+
+	q.next = q.last + 1
+	for seq := range q.pending {
+		q.next = min(q.next, seq)
+	}
+
+	return nil
+}
+
+// Put appends a value to the queue and syncs it to disk. While the queue is
+// at capacity, it waits for items to be acknowledged, which makes producers
+// slow down to the pace of the consumer instead of dropping values.
+// Returns ctx.Err() if ctx is done first, or ErrClosed if the queue is closed.
+func (q *Queue[T]) Put(ctx context.Context, value T) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return fmt.Errorf("failed to encode queue item: %w", err)
+	}
+
+	q.mu.Lock()
+	for !q.closed && len(q.pending) >= q.capacity {
+		if err := q.wait(ctx); err != nil {
+			return err
+		}
+	}
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	seq := q.last + 1
+	if err := q.append(opPut, seq, buf.Bytes()); err != nil {
+		return err
+	}
+
+	q.last = seq
+	q.pending[seq] = buf.Bytes()
+	q.notify()
+
+	return nil
+}
+
+// Get returns the oldest item that has not been delivered yet, waiting until
+// one is available. The item must be passed to Ack once it has been handled.
+// Items that cannot be decoded, e.g. because the queued type changed
+// incompatibly, are logged and acknowledged, so that they do not stay
+// pending forever.
+// Returns ctx.Err() if ctx is done first, or ErrClosed if the queue is closed.
+func (q *Queue[T]) Get(ctx context.Context) (Item[T], error) {
+	q.mu.Lock()
+	for {
+		seq, err := q.take(ctx)
+		if err != nil {
+			return Item[T]{}, err
+		}
+
+		var value T
+		err = gob.NewDecoder(bytes.NewReader(q.pending[seq])).Decode(&value)
+		if err == nil {
+			q.mu.Unlock()
+			return Item[T]{Seq: seq, Value: value}, nil
+		}
+
+		slog.Error("Discarding undecodable queue item", "queue", q.path, "seq", seq, "error", err)
+		if err := q.remove(seq); err != nil {
+			q.mu.Unlock()
+			return Item[T]{}, fmt.Errorf("failed to discard queue item %d: %w", seq, err)
+		}
+	}
+}
+
+// take marks the oldest undelivered item as delivered and returns its
+// sequence number, waiting until there is one. It must be called with the
+// lock held; the lock is held again when it returns nil and released when
+// it returns an error.
+func (q *Queue[T]) take(ctx context.Context) (uint64, error) {
+	for {
+		if q.closed {
+			q.mu.Unlock()
+			return 0, ErrClosed
+		}
+
+		// Skip items that were acknowledged since the cursor was last moved
+		for q.next <= q.last {
+			if _, ok := q.pending[q.next]; ok {
+				break
+			}
+			q.next++
+		}
+		if q.next <= q.last {
+			seq := q.next
+			q.next++
+			return seq, nil
+		}
+
+		if err := q.wait(ctx); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Ack marks an item as handled, removing it from the queue for good.
+// Acknowledging an item that is not pending has no effect.
+func (q *Queue[T]) Ack(seq uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	if _, ok := q.pending[seq]; !ok {
+		return nil
+	}
+
+	return q.remove(seq)
+}
+
+// Rewind makes every unacknowledged item deliverable again, oldest first,
+// as if the queue had been reopened. A consumer that restarts without
+// knowing which items it was handling calls it before its first Get, so
+// that no item is left pending until the process restarts. It must not be
+// called while items delivered by Get are being handled, which would be
+// delivered twice.
+func (q *Queue[T]) Rewind() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for seq := range q.pending {
+		q.next = min(q.next, seq)
+	}
+	q.notify()
+}
+
+// remove acknowledges a pending item in the log and forgets it, compacting
+// the log once enough items were acknowledged. It must be called with the
+// lock held.
+func (q *Queue[T]) remove(seq uint64) error {
+	if err := q.append(opAck, seq, nil); err != nil {
+		return err
+	}
+
+	delete(q.pending, seq)
+	q.acked++
+	q.notify()
+
+	if q.acked >= compactThreshold {
+		// The acknowledgement is logged, so a failed compaction only keeps the old log
+		if err := q.compact(); err != nil {
+			slog.Warn("Failed to compact queue log", "queue", q.path, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// Len returns the number of items that have not been acknowledged,
+// including those delivered by Get and still being handled.
+func (q *Queue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Capacity returns the maximum number of unacknowledged items.
+func (q *Queue[T]) Capacity() int {
+	return q.capacity
+}
+
+// Close closes the log file. Blocked Put and Get calls return ErrClosed.
+// Unacknowledged items remain in the log and are delivered again after
+// the queue is reopened.
+func (q *Queue[T]) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+
+	q.closed = true
+	q.notify()
+	return q.file.Close()
+}
+
+// wait releases the lock until the queue changes state or ctx is done.
+// It must be called with the lock held; the lock is held again when it
+// returns nil and released when it returns an error.
+func (q *Queue[T]) wait(ctx context.Context) error {
+	changed := q.changed
+	q.mu.Unlock()
+
+	select {
+	case <-changed:
+		q.mu.Lock()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// notify wakes up all callers waiting for the queue to change state.
+// It must be called with the lock held.
+func (q *Queue[T]) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// append writes a record to the log and syncs it to disk. If the record
+// cannot be written completely, the log is truncated back to its previous
+// end, so that no partial record is left in front of later ones, which
+// loading the log would discard. If that fails too, the queue is marked as
+// failed and every further write returns an error.
+// It must be called with the lock held.
+func (q *Queue[T]) append(op byte, seq uint64, payload []byte) error {
+	if q.failed != nil {
+		return q.failed
+	}
+
+	end, err := q.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to write queue log: %w", err)
+	}
+
+	if _, err := q.file.Write(encodeRecord(op, seq, payload)); err != nil {
+		return q.truncate(end, fmt.Errorf("failed to write queue log: %w", err))
+	}
+	if err := q.file.Sync(); err != nil {
+		return q.truncate(end, fmt.Errorf("failed to sync queue log: %w", err))
+	}
+	return nil
+}
+
+// truncate drops what was written to the log after offset end, then returns
+// err. If the log cannot be truncated, the queue is marked as failed.
+// It must be called with the lock held.
+func (q *Queue[T]) truncate(end int64, err error) error {
+	if truncateErr := q.file.Truncate(end); truncateErr != nil {
+		q.failed = fmt.Errorf("queue log is damaged: %w", errors.Join(err, truncateErr))
+		slog.Error("Failed to remove a partial record from the queue log, refusing further writes", "queue", q.path, "error", q.failed)
+		return q.failed
+	}
+	if _, seekErr := q.file.Seek(end, io.SeekStart); seekErr != nil {
+		q.failed = fmt.Errorf("queue log is damaged: %w", errors.Join(err, seekErr))
+		return q.failed
+	}
+	return err
+}
+
+// compact atomically replaces the log with one holding only the pending
+// items and appends to it from then on; if it fails, the old log is kept. It must be called with the lock held,
+// or before the queue is shared.
+func (q *Queue[T]) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), filepath.Base(q.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create queue log: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	seqs := make([]uint64, 0, len(q.pending))
+	for seq := range q.pending {
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+	for _, seq := range seqs {
+		if _, err := w.Write(encodeRecord(opPut, seq, q.pending[seq])); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write queue log: %w", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write queue log: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync queue log: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write queue log: %w", err)
+	}
+
+	// Open the new log before replacing the old one, so that the queue keeps
+	// appending to the old log if any step fails
+	file, err := os.OpenFile(tmp.Name(), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open queue log: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), q.path); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to replace queue log: %w", err)
+	}
+
+	if q.file != nil {
+		q.file.Close()
+	}
+	q.file = file
+	q.acked = 0
+	return nil
+}
+
+// encodeRecord serializes a log record.
+func encodeRecord(op byte, seq uint64, payload []byte) []byte {
+	record := make([]byte, headerSize, headerSize+len(payload))
+	record[0] = op
+	binary.BigEndian.PutUint64(record[1:], seq)
+	binary.BigEndian.PutUint32(record[9:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[13:], crc32.ChecksumIEEE(payload))
+	return append(record, payload...)
+}
+
+// readRecord reads the next log record.
+// Returns io.EOF at the clean end of the log, or another error if the
+// record is truncated or corrupt.
+func readRecord(r io.Reader) (op byte, seq uint64, payload []byte, err error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, 0, nil, fmt.Errorf("truncated record header")
+		}
+		return 0, 0, nil, err
+	}
+
+	op = header[0]
+	seq = binary.BigEndian.Uint64(header[1:])
+	size := binary.BigEndian.Uint32(header[9:])
+	if size > maxPayloadSize {
+		return 0, 0, nil, fmt.Errorf("corrupt record %d", seq)
+	}
+
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, 0, nil, fmt.Errorf("truncated record %d", seq)
+	}
+
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[13:]) || (op != opPut && op != opAck) {
+		return 0, 0, nil, fmt.Errorf("corrupt record %d", seq)
+	}
+
+	return op, seq, payload, nil
+}
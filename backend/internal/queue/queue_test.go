@@ -0,0 +1,410 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func init() {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// open opens a queue of strings at path, failing the test on error.
+func open(t *testing.T, path string, capacity int) *Queue[string] {
+	t.Helper()
+	q, err := Open[string](path, capacity)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+// put appends values to a queue, failing the test on error.
+func put(t *testing.T, q *Queue[string], values ...string) {
+	t.Helper()
+	for _, value := range values {
+		if err := q.Put(context.Background(), value); err != nil {
+			t.Fatalf("Put(%q): %v", value, err)
+		}
+	}
+}
+
+// get takes the next item from a queue, failing the test if there is none.
+func get(t *testing.T, q *Queue[string]) Item[string] {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	item, err := q.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	return item
+}
+
+// expectEmpty fails the test if a queue delivers another item.
+func expectEmpty(t *testing.T, q *Queue[string]) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if item, err := q.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get = %+v, %v, want no item", item, err)
+	}
+}
+
+// expectValues takes items from a queue and fails the test unless their
+// values are want, in order.
+func expectValues(t *testing.T, q *Queue[string], want ...string) []Item[string] {
+	t.Helper()
+	items := make([]Item[string], 0, len(want))
+	for _, value := range want {
+		item := get(t, q)
+		if item.Value != value {
+			t.Fatalf("Get = %q, want %q", item.Value, value)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func TestGetAndAck(t *testing.T) {
+	q := open(t, filepath.Join(t.TempDir(), "queue.log"), 10)
+	put(t, q, "a", "b", "c")
+
+	items := expectValues(t, q, "a", "b", "c")
+	expectEmpty(t, q)
+	if got := q.Len(); got != 3 {
+		t.Errorf("Len = %d, want 3 delivered items", got)
+	}
+
+	for _, item := range items {
+		if err := q.Ack(item.Seq); err != nil {
+			t.Fatalf("Ack: %v", err)
+		}
+	}
+	if err := q.Ack(items[0].Seq); err != nil {
+		t.Errorf("Ack of an acknowledged item: %v", err)
+	}
+	if got := q.Len(); got != 0 {
+		t.Errorf("Len = %d, want 0", got)
+	}
+}
+
+func TestReopenRedeliversUnacknowledged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	q := open(t, path, 10)
+	put(t, q, "a", "b", "c")
+	items := expectValues(t, q, "a", "b")
+	if err := q.Ack(items[0].Seq); err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+
+	q = open(t, path, 10)
+	if got := q.Len(); got != 2 {
+		t.Errorf("Len = %d, want 2", got)
+	}
+	expectValues(t, q, "b", "c")
+	expectEmpty(t, q)
+
+	// New items continue the sequence of the reopened log
+	put(t, q, "d")
+	if item := get(t, q); item.Value != "d" || item.Seq != 4 {
+		t.Errorf("Get = %+v, want d with sequence number 4", item)
+	}
+}
+
+func TestRewind(t *testing.T) {
+	q := open(t, filepath.Join(t.TempDir(), "queue.log"), 10)
+	put(t, q, "a", "b", "c")
+	items := expectValues(t, q, "a", "b")
+	if err := q.Ack(items[0].Seq); err != nil {
+		t.Fatal(err)
+	}
+
+	q.Rewind()
+	expectValues(t, q, "b", "c")
+	expectEmpty(t, q)
+}
+
+func TestRewindWakesGet(t *testing.T) {
+	q := open(t, filepath.Join(t.TempDir(), "queue.log"), 10)
+	put(t, q, "a")
+	get(t, q)
+
+	delivered := make(chan Item[string])
+	go func() {
+		item, err := q.Get(context.Background())
+		if err == nil {
+			delivered <- item
+		}
+	}()
+
+	q.Rewind()
+	select {
+	case item := <-delivered:
+		if item.Value != "a" {
+			t.Errorf("Get = %q, want a", item.Value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Get did not return after Rewind")
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	q := open(t, path, 10)
+
+	put(t, q, "kept")
+	kept := get(t, q)
+	for range compactThreshold {
+		put(t, q, "acked")
+		if err := q.Ack(get(t, q).Seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(len(encodeRecord(opPut, kept.Seq, q.pending[kept.Seq]))); info.Size() != want {
+		t.Errorf("log size = %d, want %d for the pending item only", info.Size(), want)
+	}
+
+	q.Close()
+	q = open(t, path, 10)
+	expectValues(t, q, "kept")
+	expectEmpty(t, q)
+}
+
+func TestTornRecordIsDiscarded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	q := open(t, path, 10)
+	put(t, q, "a", "b")
+	q.Close()
+
+	// Simulate a crash while the last record was being written
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+
+	q = open(t, path, 10)
+	put(t, q, "c")
+	q.Close()
+
+	// The torn record is dropped from the log, so later records are kept
+	q = open(t, path, 10)
+	expectValues(t, q, "a", "c")
+	expectEmpty(t, q)
+}
+
+func TestCorruptRecordDiscardsRest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	q := open(t, path, 10)
+	put(t, q, "a", "b", "c")
+	q.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := len(encodeRecord(opPut, 1, q.pending[1]))
+	data[first+headerSize] ^= 0xff // First payload byte of the second record
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	q = open(t, path, 10)
+	expectValues(t, q, "a")
+	expectEmpty(t, q)
+}
+
+func TestReadRecord(t *testing.T) {
+	record := encodeRecord(opPut, 7, []byte("payload"))
+
+	corrupt := func(i int) []byte {
+		data := append([]byte(nil), record...)
+		data[i] ^= 0xff
+		return data
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"valid", record, false},
+		{"truncated header", record[:headerSize-1], true},
+		{"truncated payload", record[:len(record)-1], true},
+		{"unknown operation", corrupt(0), true},
+		{"wrong checksum", corrupt(13), true},
+		{"corrupt payload", corrupt(headerSize), true},
+		{"oversized payload", corrupt(9), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, seq, payload, err := readRecord(bytes.NewReader(tt.data))
+			if tt.wantErr {
+				if err == nil || errors.Is(err, io.EOF) {
+					t.Errorf("readRecord error = %v, want a corruption error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readRecord: %v", err)
+			}
+			if op != opPut || seq != 7 || string(payload) != "payload" {
+				t.Errorf("readRecord = %d, %d, %q", op, seq, payload)
+			}
+		})
+	}
+
+	if _, _, _, err := readRecord(bytes.NewReader(nil)); !errors.Is(err, io.EOF) {
+		t.Errorf("readRecord of an empty log = %v, want io.EOF", err)
+	}
+}
+
+func TestUndecodableItemIsDiscarded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	ints, err := Open[int](path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ints.Put(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	ints.Close()
+
+	q := open(t, path, 10)
+	put(t, q, "a")
+	expectValues(t, q, "a")
+	if got := q.Len(); got != 1 {
+		t.Errorf("Len = %d, want only the delivered item", got)
+	}
+
+	q.Close()
+	q = open(t, path, 10)
+	expectValues(t, q, "a")
+	expectEmpty(t, q)
+}
+
+func TestPutWaitsAtCapacity(t *testing.T) {
+	q := open(t, filepath.Join(t.TempDir(), "queue.log"), 1)
+	put(t, q, "a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Put(ctx, "b"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Put at capacity = %v, want context.DeadlineExceeded", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- q.Put(context.Background(), "b") }()
+	if err := q.Ack(get(t, q).Seq); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Put did not return after Ack")
+	}
+	expectValues(t, q, "b")
+}
+
+func TestClose(t *testing.T) {
+	q := open(t, filepath.Join(t.TempDir(), "queue.log"), 10)
+
+	done := make(chan error)
+	go func() {
+		_, err := q.Get(context.Background())
+		done <- err
+	}()
+
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; !errors.Is(err, ErrClosed) {
+		t.Errorf("blocked Get = %v, want ErrClosed", err)
+	}
+	if err := q.Put(context.Background(), "a"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Put = %v, want ErrClosed", err)
+	}
+	if err := q.Ack(1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Ack = %v, want ErrClosed", err)
+	}
+}
+
+func TestPartialRecordIsTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	q := open(t, path, 10)
+	put(t, q, "a")
+
+	// Simulate a write that failed after part of a record was written
+	end, err := q.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := encodeRecord(opPut, 2, []byte("partial"))
+	if _, err := q.file.Write(record[:len(record)/2]); err != nil {
+		t.Fatal(err)
+	}
+	failure := errors.New("disk full")
+	if err := q.truncate(end, failure); !errors.Is(err, failure) {
+		t.Fatalf("truncate = %v, want the write error", err)
+	}
+
+	put(t, q, "b")
+	q.Close()
+
+	q = open(t, path, 10)
+	expectValues(t, q, "a", "b")
+	expectEmpty(t, q)
+}
+
+func TestDamagedLogRefusesWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	q := open(t, path, 10)
+	put(t, q, "a")
+
+	// A read-only handle can neither be written nor truncated
+	writable := q.file
+	readOnly, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.file = readOnly
+	if err := q.Put(context.Background(), "b"); err == nil {
+		t.Fatal("Put to a read-only log succeeded, want an error")
+	}
+
+	q.file = writable
+	readOnly.Close()
+	if err := q.Put(context.Background(), "c"); err == nil {
+		t.Error("Put after the log was damaged succeeded, want an error")
+	}
+	item := get(t, q)
+	if err := q.Ack(item.Seq); err == nil {
+		t.Error("Ack after the log was damaged succeeded, want an error")
+	}
+
+	q.Close()
+	q = open(t, path, 10)
+	expectValues(t, q, "a")
+	expectEmpty(t, q)
+}
@@ -0,0 +1,98 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+)
+
+// Description excerpts, in characters.
+const (
+	excerptLength  = 200 // Maximum length of an excerpt, without ellipses
+	excerptContext = 60  // Text shown before the first match
+)
+
+// highlight marks the words of a post whose terms matched a search.
+func highlight(post processor.ProcessedMessage, terms map[string]bool) Highlights {
+	highlights := Highlights{
+		Name: mark(post.Name, terms),
+		Tags: make([]string, len(post.Tags)),
+	}
+	for i, tag := range post.Tags {
+		highlights.Tags[i] = mark(tag, terms)
+	}
+	if post.Description != "" {
+		highlights.Description = excerpt(post.Description, terms)
+	}
+	return highlights
+}
+
+// mark escapes text for HTML and wraps the words whose terms are in terms
+// in <mark> elements.
+func mark(text string, terms map[string]bool) string {
+	var sb strings.Builder
+	last := 0
+	for _, token := range tokenize(text) {
+		if !terms[token.term] {
+			continue
+		}
+		sb.WriteString(html.EscapeString(text[last:token.start]))
+		sb.WriteString("<mark>")
+		sb.WriteString(html.EscapeString(text[token.start:token.end]))
+		sb.WriteString("</mark>")
+		last = token.end
+	}
+	sb.WriteString(html.EscapeString(text[last:]))
+	return sb.String()
+}
+
+// excerpt returns the part of text around its first matched word with
+// matched words marked, starting and ending at word boundaries. Ellipses
+// show where text was left out.
+func excerpt(text string, terms map[string]bool) string {
+	first := 0
+	for _, token := range tokenize(text) {
+		if terms[token.term] {
+			first = token.start
+			break
+		}
+	}
+
+	// Go back excerptContext characters and on to the start of the next word
+	start := first
+	for n := 0; n < excerptContext && start > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	if start > 0 {
+		if i := strings.IndexFunc(text[start:first], unicode.IsSpace); i >= 0 {
+			start += i
+		} else {
+			start = first
+		}
+	}
+
+	// Go forward excerptLength characters and back to the end of the previous word
+	end := start
+	for n := 0; n < excerptLength && end < len(text); n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	if end < len(text) {
+		if i := strings.LastIndexFunc(text[first:end], unicode.IsSpace); i > 0 {
+			end = first + i
+		}
+	}
+
+	snippet := mark(strings.TrimSpace(text[start:end]), terms)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(text) {
+		snippet += "…"
+	}
+	return snippet
+}
@@ -0,0 +1,417 @@
+// Package search provides an in-process full-text index of posts, so that
+// search ranks and highlights results the same way whichever store backs
+// the library.
+//
+// Names, tags and descriptions are split into words, which are stemmed as
+// English, Russian or Ukrainian, and matches are scored with BM25. Query
+// words also match the indexed words they are a prefix of and, with a lower
+// score, words within a small edit distance, so that typos still find posts.
+// The index is kept in memory: it is loaded from the post store on startup
+// and updated as the pipeline saves posts.
+package search
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// tracer creates the spans of searches.
+var tracer = otel.Tracer("github.com/kirinyoku/kirinyoku-space-web/backend/internal/search")
+
+// BM25 parameters.
+const (
+	k1 = 1.2  // Saturation of the score of repeated words
+	b  = 0.75 // Normalization of the score by the length of a field
+)
+
+// Weights of the kinds of matches between a query word and an indexed word.
+const (
+	exactWeight  = 1.0 // The words have the same stem
+	prefixWeight = 0.7 // The query word is a prefix of the indexed word
+	fuzzyWeight  = 0.5 // The words differ by one edit; halved for every further edit
+)
+
+// Minimum lengths, in characters, of query words matched by prefix or with typos.
+const (
+	minPrefixLength = 2
+	minFuzzyLength  = 4
+)
+
+// loadBatchSize is the number of posts read from the store at a time by Load.
+const loadBatchSize = 500
+
+// field is a part of a post that is indexed.
+type field int
+
+const (
+	fieldName field = iota
+	fieldTags
+	fieldDescription
+	numFields
+)
+
+// fieldWeights rank matches in names above matches in tags, and matches in
+// tags above matches in descriptions.
+var fieldWeights = [numFields]float64{
+	fieldName:        3,
+	fieldTags:        2,
+	fieldDescription: 1,
+}
+
+// key identifies a post by its Telegram chat and message IDs.
+type key struct {
+	chatID    int64
+	messageID int
+}
+
+// document is an indexed post.
+type document struct {
+	post    processor.ProcessedMessage // Post as returned in hits, with tags without "#"
+	terms   [numFields]map[string]int  // Number of occurrences of each term in each field
+	lengths [numFields]int             // Number of terms in each field
+}
+
+// Index is an inverted index of posts. It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[key]*document           // Indexed posts
+	postings map[string]map[key]struct{} // Posts containing each term in any field
+	lengths  [numFields]int              // Total number of terms in each field of all posts
+}
+
+// Hit is a post matching a search, with its score and highlighted fields.
+type Hit struct {
+	Post       processor.ProcessedMessage `json:"post"`       // Matching post
+	Score      float64                    `json:"score"`      // Relevance of the post; higher is better
+	Highlights Highlights                 `json:"highlights"` // Fields of the post with matched words marked
+}
+
+// Highlights are HTML snippets of the fields of a post in which matched words
+// are wrapped in <mark> elements. All other text is escaped.
+type Highlights struct {
+	Name        string   `json:"name"`                  // Complete name
+	Tags        []string `json:"tags"`                  // Complete tags, without "#"
+	Description string   `json:"description,omitempty"` // Excerpt of the description around its first match
+}
+
+// Results is one page of the hits of a search.
+type Results struct {
+	Hits       []Hit `json:"hits"`        // Hits on the page, most relevant first
+	TotalCount int   `json:"total_count"` // Number of posts matching the search
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[key]*document),
+		postings: make(map[string]map[key]struct{}),
+	}
+}
+
+// Load adds every post of the store to the index.
+// Returns an error if the posts cannot be read.
+func (idx *Index) Load(ctx context.Context, store storage.Store) error {
+	for page := 1; ; page++ {
+		response, err := store.GetPostsWithFilters(ctx, "", "", "", "", "", page, loadBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, post := range response.Posts {
+			idx.Add(post)
+		}
+
+		if len(response.Posts) < loadBatchSize || int64(page*loadBatchSize) >= response.TotalCount {
+			return nil
+		}
+	}
+}
+
+// Add indexes a post, replacing the post with the same chat and message IDs.
+// If the post has no ingestion time, the ingestion time of the replaced post
+// or else the current time is used, like stores do when saving a post.
+func (idx *Index) Add(post processor.ProcessedMessage) {
+	post.Source = bot.Message{}
+	post.Tags = append([]string(nil), post.Tags...)
+	for i, tag := range post.Tags {
+		post.Tags[i] = strings.TrimPrefix(tag, "#")
+	}
+
+	doc := &document{post: post}
+	texts := [numFields][]string{
+		fieldName:        {post.Name},
+		fieldTags:        post.Tags,
+		fieldDescription: {post.Description},
+	}
+	for f, fieldTexts := range texts {
+		doc.terms[f] = make(map[string]int)
+		for _, text := range fieldTexts {
+			for _, token := range tokenize(text) {
+				doc.terms[f][token.term]++
+				doc.lengths[f]++
+			}
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	k := key{chatID: post.ChatID, messageID: post.MessageID}
+	if old, ok := idx.docs[k]; ok {
+		if doc.post.IngestedAt.IsZero() {
+			doc.post.IngestedAt = old.post.IngestedAt
+		}
+		idx.remove(k, old)
+	}
+	if doc.post.IngestedAt.IsZero() {
+		doc.post.IngestedAt = time.Now().UTC()
+	}
+
+	idx.docs[k] = doc
+	for f := range numFields {
+		idx.lengths[f] += doc.lengths[f]
+		for term := range doc.terms[f] {
+			if idx.postings[term] == nil {
+				idx.postings[term] = make(map[key]struct{})
+			}
+			idx.postings[term][k] = struct{}{}
+		}
+	}
+}
+
+// remove drops an indexed post. The caller must hold the write lock.
+func (idx *Index) remove(k key, doc *document) {
+	delete(idx.docs, k)
+	for f := range numFields {
+		idx.lengths[f] -= doc.lengths[f]
+		for term := range doc.terms[f] {
+			delete(idx.postings[term], k)
+			if len(idx.postings[term]) == 0 {
+				delete(idx.postings, term)
+			}
+		}
+	}
+}
+
+// Len returns the number of indexed posts.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// Search returns one page of the posts matching every word of the query,
+// most relevant first, limited to the posts of one library unless library
+// is empty. Posts with the same score are ordered from the newest to the
+// oldest. A query without words matches nothing.
+func (idx *Index) Search(ctx context.Context, query, library string, page, limit int) Results {
+	_, span := tracer.Start(ctx, "search.query")
+	defer span.End()
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// The score of a post is the sum of the scores of the query words, all of which must match
+	words := queryWords(query)
+	var scores map[key]float64
+	matched := make(map[key]map[string]bool)
+	for _, word := range words {
+		wordScores := idx.scoreWord(word, matched)
+		if scores == nil {
+			scores = wordScores
+			continue
+		}
+		for k, score := range scores {
+			if wordScore, ok := wordScores[k]; ok {
+				scores[k] = score + wordScore
+			} else {
+				delete(scores, k)
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for k, score := range scores {
+		doc := idx.docs[k]
+		if library != "" && doc.post.Library != library {
+			continue
+		}
+		hits = append(hits, Hit{Post: doc.post, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if !hits[i].Post.Timestamp.Equal(hits[j].Post.Timestamp) {
+			return hits[i].Post.Timestamp.After(hits[j].Post.Timestamp)
+		}
+		return hits[i].Post.MessageID > hits[j].Post.MessageID
+	})
+
+	total := len(hits)
+	start := min(max(page-1, 0)*limit, total)
+	hits = hits[start:min(start+limit, total)]
+	for i := range hits {
+		post := hits[i].Post
+		hits[i].Highlights = highlight(post, matched[key{chatID: post.ChatID, messageID: post.MessageID}])
+	}
+
+	span.SetAttributes(
+		attribute.Int("search.words", len(words)),
+		attribute.Int("search.hits", total),
+	)
+	return Results{Hits: hits, TotalCount: total}
+}
+
+// queryWords returns the distinct terms of the words of a query.
+// Stemmers only remove endings, so the term of a partially typed word is
+// still a prefix of the terms of the words it starts.
+func queryWords(query string) []string {
+	var words []string
+	seen := make(map[string]bool)
+	for _, token := range tokenize(query) {
+		if !seen[token.term] {
+			seen[token.term] = true
+			words = append(words, token.term)
+		}
+	}
+	return words
+}
+
+// scoreWord returns the score of every post matching a query word: the best
+// score of an indexed term the word matches, weighted by the kind of match.
+// The terms that matched are added to matched for highlighting.
+// The caller must hold the read lock.
+func (idx *Index) scoreWord(word string, matched map[key]map[string]bool) map[key]float64 {
+	scores := make(map[key]float64)
+	for term, weight := range idx.expand(word) {
+		idf := idx.idf(term)
+		for k := range idx.postings[term] {
+			score := weight * idf * idx.termScore(idx.docs[k], term)
+			if score > scores[k] {
+				scores[k] = score
+			}
+			if matched[k] == nil {
+				matched[k] = make(map[string]bool)
+			}
+			matched[k][term] = true
+		}
+	}
+	return scores
+}
+
+// expand returns the indexed terms a query term matches, with the weight of
+// each match. The caller must hold the read lock.
+func (idx *Index) expand(term string) map[string]float64 {
+	terms := make(map[string]float64)
+	if _, ok := idx.postings[term]; ok {
+		terms[term] = exactWeight
+	}
+
+	length := runeCount(term)
+	prefix := length >= minPrefixLength
+	maxEdits := 0
+	switch {
+	case length >= 8:
+		maxEdits = 2
+	case length >= minFuzzyLength:
+		maxEdits = 1
+	}
+	if !prefix && maxEdits == 0 {
+		return terms
+	}
+
+	for candidate := range idx.postings {
+		if candidate == term {
+			continue
+		}
+		weight := 0.0
+		if prefix && strings.HasPrefix(candidate, term) {
+			weight = prefixWeight
+		}
+		if maxEdits > 0 {
+			if edits := editDistance(term, candidate, maxEdits); edits <= maxEdits {
+				weight = max(weight, fuzzyWeight/math.Pow(2, float64(edits-1)))
+			}
+		}
+		if weight > 0 {
+			terms[candidate] = weight
+		}
+	}
+	return terms
+}
+
+// idf returns the inverse document frequency of a term.
+// The caller must hold the read lock.
+func (idx *Index) idf(term string) float64 {
+	n := float64(len(idx.docs))
+	df := float64(len(idx.postings[term]))
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+// termScore returns the BM25 score of a term in a post before weighting by
+// inverse document frequency: the sum of the scores of its fields, weighted
+// by fieldWeights. The caller must hold the read lock.
+func (idx *Index) termScore(doc *document, term string) float64 {
+	score := 0.0
+	for f := range numFields {
+		tf := float64(doc.terms[f][term])
+		if tf == 0 {
+			continue
+		}
+		averageLength := float64(idx.lengths[f]) / float64(len(idx.docs))
+		norm := 1 - b + b*float64(doc.lengths[f])/averageLength
+		score += fieldWeights[f] * tf * (k1 + 1) / (tf + k1*norm)
+	}
+	return score
+}
+
+// editDistance returns the Damerau-Levenshtein distance between two terms,
+// counting the transposition of adjacent characters as one edit, or
+// maxEdits+1 if the distance exceeds maxEdits.
+func editDistance(a, b string, maxEdits int) int {
+	s, t := []rune(a), []rune(b)
+	if d := len(s) - len(t); d > maxEdits || -d > maxEdits {
+		return maxEdits + 1
+	}
+
+	// Rows of the distance matrix for the previous two and the current prefix of s
+	prev2 := make([]int, len(t)+1)
+	prev := make([]int, len(t)+1)
+	curr := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > maxEdits {
+			return maxEdits + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+
+	return min(prev[len(t)], maxEdits+1)
+}
@@ -0,0 +1,285 @@
+package search
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+)
+
+// base is the publication time of the oldest test post.
+var base = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newPost returns a post of the test library published id hours after base.
+func newPost(id int, name, description string, tags ...string) processor.ProcessedMessage {
+	return processor.ProcessedMessage{
+		ChatID:      1,
+		MessageID:   id,
+		Library:     "books",
+		Name:        name,
+		Description: description,
+		Tags:        tags,
+		Timestamp:   base.Add(time.Duration(id) * time.Hour),
+	}
+}
+
+// ids returns the message IDs of hits in order.
+func ids(hits []Hit) []int {
+	result := make([]int, len(hits))
+	for i, hit := range hits {
+		result[i] = hit.Post.MessageID
+	}
+	return result
+}
+
+func TestSearchRanking(t *testing.T) {
+	idx := NewIndex()
+	for _, post := range []processor.ProcessedMessage{
+		newPost(1, "Go concurrency patterns", "", "#go"),
+		newPost(2, "Learning Rust", "A comparison that mentions Go once", "rust"),
+		newPost(3, "Concurrent programming in Rust", "", "rust"),
+		newPost(4, "Книги о программировании", "", "ru"),
+		newPost(5, "Бібліотеки українською", "", "uk"),
+		newPost(6, "Go concurrency patterns", "", "#go"),
+	} {
+		idx.Add(post)
+	}
+	other := newPost(7, "Go in another library", "")
+	other.Library = "papers"
+	idx.Add(other)
+
+	tests := []struct {
+		name    string
+		query   string
+		library string
+		want    []int
+	}{
+		{"name ranks above description", "go", "books", []int{6, 1, 2}},
+		{"equal scores newest first", "patterns", "", []int{6, 1}},
+		{"all words must match", "go rust", "", []int{2}},
+		{"exact match ranks above typo", "concurrency", "", []int{6, 1, 3}},
+		{"prefix of a word", "progr", "", []int{3}},
+		{"transposed letters", "rsut", "", []int{2, 3}},
+		{"library", "go", "papers", []int{7}},
+		{"Russian word form", "книга", "", []int{4}},
+		{"Russian prefix", "программ", "", []int{4}},
+		{"Ukrainian word form", "бібліотека", "", []int{5}},
+		{"no words", "?!", "", nil},
+		{"no match", "haskell", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := idx.Search(context.Background(), tt.query, tt.library, 1, 10)
+			if got := ids(results.Hits); !slices.Equal(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+			if results.TotalCount != len(tt.want) {
+				t.Errorf("TotalCount = %d, want %d", results.TotalCount, len(tt.want))
+			}
+			for i := 1; i < len(results.Hits); i++ {
+				if results.Hits[i].Score > results.Hits[i-1].Score {
+					t.Errorf("hit %d scores %v, above the previous hit", i, results.Hits[i].Score)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchPagination(t *testing.T) {
+	idx := NewIndex()
+	for id := 1; id <= 5; id++ {
+		idx.Add(newPost(id, "Go", ""))
+	}
+
+	results := idx.Search(context.Background(), "go", "", 2, 2)
+	if got, want := ids(results.Hits), []int{3, 2}; !slices.Equal(got, want) {
+		t.Errorf("page 2 = %v, want %v", got, want)
+	}
+	if results.TotalCount != 5 {
+		t.Errorf("TotalCount = %d, want 5", results.TotalCount)
+	}
+
+	if results := idx.Search(context.Background(), "go", "", 4, 2); len(results.Hits) != 0 {
+		t.Errorf("page past the end = %v, want no hits", ids(results.Hits))
+	}
+}
+
+func TestAddReplacesPost(t *testing.T) {
+	idx := NewIndex()
+	idx.Add(newPost(1, "Go patterns", ""))
+	idx.Add(newPost(1, "Rust patterns", ""))
+
+	if idx.Len() != 1 {
+		t.Errorf("Len = %d, want 1", idx.Len())
+	}
+	if results := idx.Search(context.Background(), "go", "", 1, 10); results.TotalCount != 0 {
+		t.Errorf("words of the replaced post still match %v", ids(results.Hits))
+	}
+	if results := idx.Search(context.Background(), "rust", "", 1, 10); results.TotalCount != 1 {
+		t.Errorf("words of the new post match %d posts, want 1", results.TotalCount)
+	}
+}
+
+func TestStem(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		// English
+		{"connections", "connection"},
+		{"caresses", "caress"},
+		{"ponies", "poni"},
+		{"running", "run"},
+		{"hoped", "hope"},
+		{"agreed", "agree"},
+		{"happy", "happi"},
+		{"go", "go"},
+		{"café", "café"},
+
+		// Russian
+		{"книги", "книг"},
+		{"книга", "книг"},
+		{"программировании", "программирован"},
+		{"учиться", "уч"},
+		{"елки", "елк"},
+
+		// Ukrainian
+		{"бібліотеки", "бібліотек"},
+		{"бібліотека", "бібліотек"},
+		{"українською", "українськ"},
+
+		// Other
+		{"2024", "2024"},
+		{"東京", "東京"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			if got := stem(tt.word); got != tt.want {
+				t.Errorf("stem(%q) = %q, want %q", tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []token
+	}{
+		{"Go, Rust!", []token{{"go", 0, 2}, {"rust", 4, 8}}},
+		{"Ёлки и палки", []token{{"елк", 0, 8}, {"и", 9, 11}, {"палк", 12, 22}}},
+		{"🎄 go 🎄", []token{{"go", 5, 7}}},
+		{"за\u0301", []token{{"за", 0, 6}}},
+		{"C++ 2024", []token{{"c", 0, 1}, {"2024", 4, 8}}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := tokenize(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("tokenize(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		maxEdits int
+		want     int
+	}{
+		{"rust", "rust", 1, 0},
+		{"rust", "rsut", 1, 1},
+		{"rust", "rusty", 1, 1},
+		{"rust", "bust", 1, 1},
+		{"rust", "trust", 2, 1},
+		{"concurrenci", "concurrent", 2, 2},
+		{"rust", "go", 1, 2},
+		{"книга", "кинга", 1, 1},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b, tt.maxEdits); got != tt.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.maxEdits, got, tt.want)
+		}
+	}
+}
+
+func TestMark(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		terms []string
+		want  string
+	}{
+		{"every occurrence", "Go and go", []string{"go"}, "<mark>Go</mark> and <mark>go</mark>"},
+		{"word forms", "Ёлки и ёлка", []string{"елк"}, "<mark>Ёлки</mark> и <mark>ёлка</mark>"},
+		{"around emoji", "🎄go🎄 Rust", []string{"go", "rust"}, "🎄<mark>go</mark>🎄 <mark>Rust</mark>"},
+		{"escaped text", "<b>Go</b> & co", []string{"go"}, "&lt;b&gt;<mark>Go</mark>&lt;/b&gt; &amp; co"},
+		{"no match", "Rust", []string{"go"}, "Rust"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			terms := make(map[string]bool)
+			for _, term := range tt.terms {
+				terms[term] = true
+			}
+			if got := mark(tt.text, terms); got != tt.want {
+				t.Errorf("mark(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	terms := map[string]bool{"go": true}
+
+	if got, want := excerpt("Learn Go quickly", terms), "Learn <mark>Go</mark> quickly"; got != want {
+		t.Errorf("excerpt of a short text = %q, want %q", got, want)
+	}
+
+	// A long text is cut at word boundaries around the first match
+	words := strings.Repeat("слово ", 50)
+	text := words + "Go " + words
+	got := excerpt(text, terms)
+	if !strings.HasPrefix(got, "…слово ") || !strings.HasSuffix(got, "слово…") {
+		t.Errorf("excerpt = %q, want whole words between ellipses", got)
+	}
+	if !strings.Contains(got, "<mark>Go</mark>") {
+		t.Errorf("excerpt = %q, want the match marked", got)
+	}
+	plain := strings.NewReplacer("<mark>", "", "</mark>", "", "…", "").Replace(got)
+	if n := runeCount(plain); n > excerptLength {
+		t.Errorf("excerpt has %d characters, want at most %d", n, excerptLength)
+	}
+	if before := strings.Index(plain, "Go"); runeCount(plain[:before]) > excerptContext {
+		t.Errorf("excerpt starts %d characters before the match, want at most %d", runeCount(plain[:before]), excerptContext)
+	}
+}
+
+func TestSearchHighlights(t *testing.T) {
+	idx := NewIndex()
+	idx.Add(newPost(1, "Learning Go", "Go & <generics>", "#golang", "go"))
+
+	results := idx.Search(context.Background(), "go", "", 1, 10)
+	if len(results.Hits) != 1 {
+		t.Fatalf("hits = %v, want post 1", ids(results.Hits))
+	}
+
+	want := Highlights{
+		Name:        "Learning <mark>Go</mark>",
+		Tags:        []string{"<mark>golang</mark>", "<mark>go</mark>"},
+		Description: "<mark>Go</mark> &amp; &lt;generics&gt;",
+	}
+	got := results.Hits[0].Highlights
+	if got.Name != want.Name || !slices.Equal(got.Tags, want.Tags) || got.Description != want.Description {
+		t.Errorf("Highlights = %+v, want %+v", got, want)
+	}
+}
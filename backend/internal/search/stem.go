@@ -0,0 +1,223 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Stemmers are light: they remove inflectional endings, so that the forms
+// of a word share a term, but keep derivational suffixes. Words shorter than
+// minStemLength characters are left alone.
+const minStemLength = 3
+
+// stem reduces a normalized word to its stem with the stemmer of its
+// language, which is told apart by the script: Latin words are stemmed as
+// English, and Cyrillic words as Ukrainian if they contain a letter only
+// Ukrainian uses, and as Russian otherwise. Other words are kept as they are.
+func stem(word string) string {
+	if runeCount(word) < minStemLength {
+		return word
+	}
+
+	switch {
+	case strings.ContainsAny(word, "іїєґ"):
+		return stemCyrillic(word, ukrainianVowels, ukrainianEndings)
+	case strings.IndexFunc(word, isCyrillic) >= 0:
+		return stemCyrillic(word, russianVowels, russianEndings)
+	case strings.IndexFunc(word, isLatin) >= 0:
+		return stemEnglish(word)
+	default:
+		return word
+	}
+}
+
+// isCyrillic reports whether r is a Cyrillic letter.
+func isCyrillic(r rune) bool {
+	return unicode.Is(unicode.Cyrillic, r)
+}
+
+// isLatin reports whether r is a Latin letter.
+func isLatin(r rune) bool {
+	return unicode.Is(unicode.Latin, r)
+}
+
+const (
+	russianVowels   = "аеиоуыэюя"
+	ukrainianVowels = "аеєиіїоуюя"
+)
+
+// reflexiveSuffixes end reflexive verbs in both Russian and Ukrainian.
+var reflexiveSuffixes = []string{"ся", "сь"}
+
+// Inflectional endings of nouns, adjectives, participles and verbs, longest first.
+var (
+	russianEndings = byLengthDescending([]string{
+		"иями", "ями", "ами", "иях", "ях", "ах", "ием", "ем", "ом", "ам", "ям", "иям",
+		"ией", "ей", "ой", "ий", "ый", "ая", "яя", "ое", "ее", "ие", "ые",
+		"ого", "его", "ому", "ему", "ими", "ыми", "ых", "их", "ую", "юю", "ою", "ею",
+		"ешь", "ете", "ите", "ить", "ать", "ять", "еть", "уть", "ть", "ет", "ит",
+		"ют", "ут", "ят", "ат", "ла", "ло", "ли", "ил", "ыл", "ев", "ов", "ье", "ья",
+		"ию", "ью", "ия", "ии", "еи",
+		"а", "е", "и", "й", "о", "у", "ы", "ь", "ю", "я",
+	})
+	ukrainianEndings = byLengthDescending([]string{
+		"ами", "ями", "ах", "ях", "ам", "ям", "ом", "ем", "ою", "ею", "єю", "ів", "їв", "ов", "ев",
+		"ого", "ому", "ими", "ій", "ий", "ої", "их", "им", "ім", "ая", "яя", "ую", "юю",
+		"ати", "ити", "іти", "ють", "ять", "уть", "ать", "ить", "ти", "ть", "ете", "єте", "емо",
+		"ємо", "имо", "ите", "ла", "ло", "ли", "ив",
+		"а", "е", "є", "и", "і", "ї", "й", "о", "у", "ь", "ю", "я",
+	})
+)
+
+// stemCyrillic removes a reflexive suffix and then the longest inflectional
+// ending of a Russian or Ukrainian word. Endings are only removed after the
+// first vowel of the word, so that at least one syllable remains.
+func stemCyrillic(word, vowels string, endings []string) string {
+	first := strings.IndexAny(word, vowels)
+	if first < 0 {
+		return word
+	}
+	// The region from which endings may be removed starts after the first vowel
+	_, size := utf8.DecodeRuneInString(word[first:])
+	region := first + size
+
+	for _, suffix := range reflexiveSuffixes {
+		if strings.HasSuffix(word, suffix) && len(word)-len(suffix) >= region {
+			word = strings.TrimSuffix(word, suffix)
+			break
+		}
+	}
+	for _, ending := range endings {
+		if strings.HasSuffix(word, ending) && len(word)-len(ending) >= region && runeCount(word)-runeCount(ending) >= 2 {
+			return strings.TrimSuffix(word, ending)
+		}
+	}
+	return word
+}
+
+// byLengthDescending sorts endings from the longest to the shortest, so that
+// the longest matching ending is removed.
+func byLengthDescending(endings []string) []string {
+	sort.SliceStable(endings, func(i, j int) bool {
+		return runeCount(endings[i]) > runeCount(endings[j])
+	})
+	return endings
+}
+
+// stemEnglish removes the plural, past tense and gerund endings of an
+// English word, following steps 1a to 1c of the Porter stemmer.
+func stemEnglish(word string) string {
+	w := []byte(word)
+	if strings.IndexFunc(word, func(r rune) bool { return r > unicode.MaxASCII }) >= 0 {
+		// Accented Latin words are not English
+		return word
+	}
+
+	// Step 1a: plurals
+	switch {
+	case hasSuffix(w, "sses"):
+		w = w[:len(w)-2]
+	case hasSuffix(w, "ies"):
+		w = w[:len(w)-2]
+	case hasSuffix(w, "ss"):
+	case hasSuffix(w, "s"):
+		w = w[:len(w)-1]
+	}
+
+	// Step 1b: past tense and gerunds
+	switch {
+	case hasSuffix(w, "eed"):
+		if measure(w[:len(w)-3]) > 0 {
+			w = w[:len(w)-1]
+		}
+	case hasSuffix(w, "ed") && containsVowel(w[:len(w)-2]):
+		w = restoreEnding(w[:len(w)-2])
+	case hasSuffix(w, "ing") && containsVowel(w[:len(w)-3]):
+		w = restoreEnding(w[:len(w)-3])
+	}
+
+	// Step 1c: a final y after a vowel-containing stem
+	if hasSuffix(w, "y") && containsVowel(w[:len(w)-1]) {
+		w[len(w)-1] = 'i'
+	}
+
+	return string(w)
+}
+
+// restoreEnding tidies a stem whose -ed or -ing ending was removed:
+// "conflat" becomes "conflate", "hopp" becomes "hop" and "hop" becomes "hope".
+func restoreEnding(w []byte) []byte {
+	switch {
+	case hasSuffix(w, "at"), hasSuffix(w, "bl"), hasSuffix(w, "iz"):
+		return append(w, 'e')
+	case endsWithDoubleConsonant(w) && !hasSuffix(w, "l") && !hasSuffix(w, "s") && !hasSuffix(w, "z"):
+		return w[:len(w)-1]
+	case measure(w) == 1 && endsWithCVC(w):
+		return append(w, 'e')
+	}
+	return w
+}
+
+// hasSuffix reports whether w ends with suffix.
+func hasSuffix(w []byte, suffix string) bool {
+	return strings.HasSuffix(string(w), suffix)
+}
+
+// isConsonant reports whether the letter at i is a consonant in the sense
+// of the Porter stemmer: y is a consonant unless it follows a consonant.
+func isConsonant(w []byte, i int) bool {
+	switch w[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !isConsonant(w, i-1)
+	}
+	return true
+}
+
+// measure returns the number of vowel-consonant sequences in w.
+func measure(w []byte) int {
+	m := 0
+	vowel := false
+	for i := range w {
+		if !isConsonant(w, i) {
+			vowel = true
+		} else if vowel {
+			m++
+			vowel = false
+		}
+	}
+	return m
+}
+
+// containsVowel reports whether w contains a vowel.
+func containsVowel(w []byte) bool {
+	for i := range w {
+		if !isConsonant(w, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// endsWithDoubleConsonant reports whether w ends with the same consonant twice.
+func endsWithDoubleConsonant(w []byte) bool {
+	n := len(w)
+	return n >= 2 && w[n-1] == w[n-2] && isConsonant(w, n-1)
+}
+
+// endsWithCVC reports whether w ends with a consonant, a vowel and a
+// consonant other than w, x or y, as in "hop".
+func endsWithCVC(w []byte) bool {
+	n := len(w)
+	if n < 3 || !isConsonant(w, n-3) || isConsonant(w, n-2) || !isConsonant(w, n-1) {
+		return false
+	}
+	switch w[n-1] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
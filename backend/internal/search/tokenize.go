@@ -0,0 +1,65 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// token is a word of a text together with its position.
+type token struct {
+	term       string // Normalized and stemmed form of the word
+	start, end int    // Byte offsets of the word in the text
+}
+
+// tokenize splits text into words, which are runs of letters and digits,
+// and reduces each word to the term it is indexed under.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, newToken(text, start, i))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, newToken(text, start, len(text)))
+	}
+	return tokens
+}
+
+// newToken returns the token of the word at text[start:end].
+func newToken(text string, start, end int) token {
+	return token{term: stem(normalize(text[start:end])), start: start, end: end}
+}
+
+// isWordRune reports whether r is part of a word.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r)
+}
+
+// normalize lowercases a word and folds letters that are written
+// interchangeably, so that "Ёлка" and "елка" are the same word.
+func normalize(word string) string {
+	return strings.Map(func(r rune) rune {
+		switch r = unicode.ToLower(r); r {
+		case 'ё':
+			return 'е'
+		case '\u0301': // Combining acute accent marking stress
+			return -1
+		}
+		return r
+	}, word)
+}
+
+// runeCount returns the number of characters of a term.
+func runeCount(term string) int {
+	return utf8.RuneCountInString(term)
+}
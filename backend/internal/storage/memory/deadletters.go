@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+)
+
+// DeadLetters keeps the entries of failed messages in memory. It implements
+// deadletter.Store and is safe for concurrent use.
+type DeadLetters struct {
+	mu      sync.RWMutex                 // Guards entries
+	entries map[string]*deadletter.Entry // Entries by ID
+}
+
+// NewDeadLetters creates an empty dead-letter store.
+func NewDeadLetters() *DeadLetters {
+	return &DeadLetters{entries: make(map[string]*deadletter.Entry)}
+}
+
+// Record stores the entry of a failed message, replacing the stored message,
+// stage and error with the latest ones and incrementing the attempt count.
+func (d *DeadLetters) Record(ctx context.Context, msg bot.Message, stage deadletter.Stage, failure error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now().UTC()
+	id := deadletter.EntryID(msg.ChatID, msg.MessageID)
+	entry, ok := d.entries[id]
+	if !ok {
+		entry = &deadletter.Entry{ID: id, CreatedAt: now}
+		d.entries[id] = entry
+	}
+	entry.Message = msg
+	entry.Stage = stage
+	entry.Error = failure.Error()
+	entry.Attempts++
+	entry.UpdatedAt = now
+	return nil
+}
+
+// Resolve removes the entry of a message, if there is one.
+func (d *DeadLetters) Resolve(ctx context.Context, chatID int64, messageID int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.entries, deadletter.EntryID(chatID, messageID))
+	return nil
+}
+
+// List retrieves dead-letter entries with pagination, most recent failures
+// first, and entries that failed at the same time by ID.
+func (d *DeadLetters) List(ctx context.Context, page, limit int) (deadletter.Page, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	entries := make([]deadletter.Entry, 0, len(d.entries))
+	for _, entry := range d.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].UpdatedAt.Equal(entries[j].UpdatedAt) {
+			return entries[i].UpdatedAt.After(entries[j].UpdatedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+
+	return deadletter.Page{
+		Entries:    append([]deadletter.Entry{}, paginate(entries, page, limit)...),
+		TotalCount: int64(len(entries)),
+	}, nil
+}
+
+// Get retrieves a single dead-letter entry.
+// Returns deadletter.ErrNotFound if no such entry exists.
+func (d *DeadLetters) Get(ctx context.Context, id string) (deadletter.Entry, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	entry, ok := d.entries[id]
+	if !ok {
+		return deadletter.Entry{}, deadletter.ErrNotFound
+	}
+	return *entry, nil
+}
+
+// Delete discards a dead-letter entry.
+// Returns deadletter.ErrNotFound if no such entry exists.
+func (d *DeadLetters) Delete(ctx context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.entries[id]; !ok {
+		return deadletter.ErrNotFound
+	}
+	delete(d.entries, id)
+	return nil
+}
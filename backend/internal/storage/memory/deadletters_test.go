@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter/deadlettertest"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage/memory"
+)
+
+func TestDeadLetters(t *testing.T) {
+	deadlettertest.Run(t, func(t *testing.T) deadletter.Store {
+		return memory.NewDeadLetters()
+	})
+}
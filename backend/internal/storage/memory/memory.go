@@ -0,0 +1,285 @@
+// Package memory provides an in-memory implementation of storage.Store for
+// tests and local development. It follows the filter, ordering and
+// pagination semantics of the MongoDB store; posts are lost on exit.
+package memory
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/translit"
+)
+
+// languagePattern matches the tags that denote the language of a post.
+var languagePattern = regexp.MustCompile(`^[a-z]{2}$`)
+
+// key identifies a post by its Telegram chat and message IDs.
+type key struct {
+	chatID    int64
+	messageID int
+}
+
+// post is a stored post together with its insertion order, which breaks
+// ties between posts with the same timestamp like MongoDB's _id does, and
+// its folded name, which transliterated searches match.
+type post struct {
+	message processor.ProcessedMessage
+	seq     uint64
+	folded  string
+}
+
+// Store keeps posts in memory. It is safe for concurrent use.
+type Store struct {
+	mu    sync.RWMutex  // Guards posts and seq
+	posts map[key]*post // Stored posts by chat and message ID
+	seq   uint64        // Insertion order of the last inserted post
+}
+
+// New creates an empty Store.
+func New() *Store {
+	return &Store{posts: make(map[key]*post)}
+}
+
+// SaveMessage inserts a post, or replaces the stored fields of the post with
+// the same chat and message IDs while keeping its ingestion time.
+func (s *Store) SaveMessage(ctx context.Context, message processor.ProcessedMessage) error {
+	message = clone(message)
+	message.Source = bot.Message{} // Not persisted by the other stores either
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := key{message.ChatID, message.MessageID}
+	if existing, ok := s.posts[k]; ok {
+		message.IngestedAt = existing.message.IngestedAt
+		existing.message = message
+		existing.folded = translit.Fold(message.Name)
+		return nil
+	}
+
+	s.seq++
+	message.IngestedAt = time.Now().UTC()
+	s.posts[k] = &post{message: message, seq: s.seq, folded: translit.Fold(message.Name)}
+	return nil
+}
+
+// GetPostsWithFilters retrieves posts with specified filters and pagination,
+// ordered from the newest to the oldest Telegram post.
+// query is parsed and matched like the MongoDB store matches it, see
+// storage.ParseSearch: at least one of its words must be a word of the
+// name, tags, description or folded name of a post, all of its phrases must
+// be found in one of them and none of its excluded words or phrases may be.
+// Words match if one of their variants does, see translit.Variants. Queries
+// shorter than minTextSearchLength match posts with a word of the name
+// starting with the query, or a word of the folded name starting with a
+// variant of it, instead. language matches the last tag exactly.
+func (s *Store) GetPostsWithFilters(ctx context.Context, query, tag, postType, language, library string, page, limit int) (storage.PostsResponse, error) {
+	return s.getPosts(query, tag, postType, language, library, page, limit, false)
+}
+
+// GetPostsWithFacets is like GetPostsWithFilters, but also counts the types,
+// tags and languages of all matching posts.
+func (s *Store) GetPostsWithFacets(ctx context.Context, query, tag, postType, language, library string, page, limit int) (storage.PostsResponse, error) {
+	return s.getPosts(query, tag, postType, language, library, page, limit, true)
+}
+
+// getPosts retrieves one page of the posts matching the filters and, if
+// facets is set, counts the values of all matching posts.
+func (s *Store) getPosts(query, tag, postType, language, library string, page, limit int, facets bool) (storage.PostsResponse, error) {
+	var search *search
+	if query != "" {
+		search = parseSearch(query)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matches []*post
+	for _, p := range s.posts {
+		m := p.message
+		switch {
+		case library != "" && m.Library != library,
+			search != nil && !search.matches(p),
+			postType != "" && m.Type != postType,
+			tag != "" && !slices.Contains(m.Tags, tag),
+			language != "" && (len(m.Tags) == 0 || m.Tags[len(m.Tags)-1] != language):
+			continue
+		}
+		matches = append(matches, p)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if !a.message.Timestamp.Equal(b.message.Timestamp) {
+			return a.message.Timestamp.After(b.message.Timestamp)
+		}
+		return a.seq > b.seq
+	})
+
+	var posts []processor.ProcessedMessage
+	for _, p := range paginate(matches, page, limit) {
+		message := clone(p.message)
+		for i, tag := range message.Tags {
+			message.Tags[i] = strings.TrimPrefix(tag, "#")
+		}
+		posts = append(posts, message)
+	}
+
+	response := storage.PostsResponse{Posts: posts, TotalCount: int64(len(matches))}
+	if facets {
+		response.Facets = countFacets(matches)
+	}
+	return response, nil
+}
+
+// countFacets counts the types, tags and languages of posts.
+func countFacets(posts []*post) *storage.Facets {
+	types := make(map[string]int64)
+	tags := make(map[string]int64)
+	languages := make(map[string]int64)
+	for _, p := range posts {
+		m := p.message
+		if m.Type != "" {
+			types[m.Type]++
+		}
+		seen := make(map[string]bool)
+		for _, tag := range m.Tags {
+			if tag = strings.TrimPrefix(tag, "#"); !seen[tag] {
+				seen[tag] = true
+				tags[tag]++
+			}
+		}
+		if len(m.Tags) > 0 && languagePattern.MatchString(m.Tags[len(m.Tags)-1]) {
+			languages[m.Tags[len(m.Tags)-1]]++
+		}
+	}
+
+	return &storage.Facets{
+		Types:     sortCounts(types),
+		Tags:      sortCounts(tags),
+		Languages: sortCounts(languages),
+	}
+}
+
+// sortCounts returns the counts of values from the most to the least
+// frequent value, and in ascending order of equally frequent values.
+func sortCounts(counts map[string]int64) []storage.FacetCount {
+	result := make([]storage.FacetCount, 0, len(counts))
+	for value, count := range counts {
+		result = append(result, storage.FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+	return result
+}
+
+// GetPost retrieves the post stored for a Telegram message.
+// Returns storage.ErrNotFound if no such post exists.
+func (s *Store) GetPost(ctx context.Context, chatID int64, messageID int) (processor.ProcessedMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.posts[key{chatID, messageID}]
+	if !ok {
+		return processor.ProcessedMessage{}, storage.ErrNotFound
+	}
+	return clone(p.message), nil
+}
+
+// GetTags retrieves all unique tags, limited to the posts of one library
+// unless library is empty
+func (s *Store) GetTags(ctx context.Context, library string) ([]string, error) {
+	return s.collect(library, func(m processor.ProcessedMessage) []string {
+		tags := make([]string, len(m.Tags))
+		for i, tag := range m.Tags {
+			tags[i] = strings.TrimPrefix(tag, "#")
+		}
+		return tags
+	}), nil
+}
+
+// GetLanguages retrieves all unique language codes from tags, limited to the
+// posts of one library unless library is empty
+func (s *Store) GetLanguages(ctx context.Context, library string) ([]string, error) {
+	return s.collect(library, func(m processor.ProcessedMessage) []string {
+		if len(m.Tags) == 0 || !languagePattern.MatchString(m.Tags[len(m.Tags)-1]) {
+			return nil
+		}
+		return m.Tags[len(m.Tags)-1:]
+	}), nil
+}
+
+// GetLibraries retrieves the identifiers of all libraries that have posts
+func (s *Store) GetLibraries(ctx context.Context) ([]string, error) {
+	return s.collect("", func(m processor.ProcessedMessage) []string {
+		if m.Library == "" {
+			return nil
+		}
+		return []string{m.Library}
+	}), nil
+}
+
+// Ping always succeeds.
+func (s *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+// collect returns the sorted unique values that values extracts from the
+// posts of one library, or of all posts if library is empty.
+func (s *Store) collect(library string, values func(processor.ProcessedMessage) []string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	unique := make(map[string]struct{})
+	for _, p := range s.posts {
+		if library != "" && p.message.Library != library {
+			continue
+		}
+		for _, value := range values(p.message) {
+			unique[value] = struct{}{}
+		}
+	}
+
+	result := make([]string, 0, len(unique))
+	for value := range unique {
+		result = append(result, value)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// paginate returns the items of a page, counting pages from 1.
+// A limit of 0 returns all items from the start of the page, like MongoDB.
+func paginate[T any](items []T, page, limit int) []T {
+	skip := max((page-1)*limit, 0)
+	if skip >= len(items) {
+		return nil
+	}
+	if limit <= 0 {
+		return items[skip:]
+	}
+	return items[skip:min(skip+limit, len(items))]
+}
+
+// clone returns a copy of a message that shares no slices with the original.
+func clone(message processor.ProcessedMessage) processor.ProcessedMessage {
+	message.Tags = slices.Clone(message.Tags)
+	message.Links = slices.Clone(message.Links)
+	if message.Attachment != nil {
+		attachment := *message.Attachment
+		message.Attachment = &attachment
+	}
+	return message
+}
@@ -0,0 +1,93 @@
+package memory_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage/memory"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage/storagetest"
+)
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		return memory.New()
+	})
+}
+
+func TestSearch(t *testing.T) {
+	store := memory.New()
+	storagetest.Fill(t, store)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []int
+	}{
+		{"any word", "rust learning", []int{5, 1}},
+		{"word of tag", "cpp", []int{2}},
+		{"word of description", "channels", []int{3}},
+		{"whole words only", "concur", nil},
+		{"phrase", `"concurrency patterns"`, []int{3}},
+		{"phrase must match", `go "gentle introduction"`, []int{1}},
+		{"exclusion", "go -concurrency", []int{1}},
+		{"excluded phrase", `go -"learning go"`, []int{3}},
+		{"exclusion only", "-go", []int{5, 4, 2}},
+		{"short query matches word start", "ru", []int{5}},
+		{"short transliterated query", "pr", []int{4, 2}},
+		{"regular expression characters", "c++", []int{2}},
+		{"short pattern", ".*", nil},
+		{"pattern", "[q-w]+", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := store.GetPostsWithFilters(context.Background(), tt.query, "", "", "", "", 1, 10)
+			if err != nil {
+				t.Fatalf("GetPostsWithFilters: %v", err)
+			}
+			if got := storagetest.IDs(response.Posts); !slices.Equal(got, tt.want) {
+				t.Errorf("posts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetTagsMergesPrefixedTags(t *testing.T) {
+	store := memory.New()
+	for id, tag := range []string{"#go", "go"} {
+		post := processor.ProcessedMessage{ChatID: 1, MessageID: id, Tags: []string{tag}}
+		if err := store.SaveMessage(context.Background(), post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tags, err := store.GetTags(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"go"}; !slices.Equal(tags, want) {
+		t.Errorf("GetTags = %v, want %v", tags, want)
+	}
+}
+
+func TestSaveMessageCopiesSlices(t *testing.T) {
+	store := memory.New()
+	ctx := context.Background()
+
+	tags := []string{"go"}
+	if err := store.SaveMessage(ctx, processor.ProcessedMessage{ChatID: 1, MessageID: 1, Tags: tags}); err != nil {
+		t.Fatal(err)
+	}
+	tags[0] = "changed"
+
+	post, err := store.GetPost(ctx, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Tags[0] != "go" {
+		t.Errorf("Tags = %v, want the saved tags", post.Tags)
+	}
+}
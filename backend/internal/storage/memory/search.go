@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/translit"
+)
+
+// minTextSearchLength is the length, in characters, below which a query is
+// matched as the prefix of a word of the name instead of as whole words,
+// like in the MongoDB store.
+const minTextSearchLength = 3
+
+// wordStart is a regular expression matching the start of a word.
+const wordStart = `(?:^|[^\p{L}\p{N}])`
+
+// search is a query prepared for matching posts. Either prefix and
+// foldedPrefix are set, or the query is matched by its words and phrases.
+type search struct {
+	prefix       *regexp.Regexp // Matches names with a word starting with a short query
+	foldedPrefix *regexp.Regexp // Matches folded names with a word starting with a variant of a short query
+	terms        [][]string     // Words of the variants of each word, of which one must match
+	phrases      []string       // Lowercased phrases that must all be found
+	excluded     []string       // Lowercased words or phrases that must not be found
+}
+
+// parseSearch prepares a query for matching. The parts of the query are
+// always matched literally.
+func parseSearch(query string) *search {
+	query = strings.TrimSpace(query)
+	parsed := storage.ParseSearch(query)
+	if utf8.RuneCountInString(query) < minTextSearchLength || parsed.Empty() {
+		variants := translit.Variants(query)
+		for i, variant := range variants {
+			variants[i] = regexp.QuoteMeta(variant)
+		}
+		return &search{
+			prefix:       regexp.MustCompile("(?i)" + wordStart + variants[0]),
+			foldedPrefix: regexp.MustCompile("(?i)" + wordStart + "(?:" + strings.Join(variants, "|") + ")"),
+		}
+	}
+
+	s := &search{}
+	for _, term := range parsed.Terms {
+		var words []string
+		for _, variant := range translit.Variants(term) {
+			words = append(words, splitWords(variant)...)
+		}
+		s.terms = append(s.terms, words)
+	}
+	for _, phrase := range parsed.Phrases {
+		s.phrases = append(s.phrases, strings.ToLower(phrase))
+	}
+	for _, excluded := range parsed.Excluded {
+		s.excluded = append(s.excluded, strings.ToLower(excluded))
+	}
+	return s
+}
+
+// matches reports whether a post matches the query.
+func (s *search) matches(p *post) bool {
+	m := p.message
+	if s.prefix != nil {
+		return s.prefix.MatchString(m.Name) || s.foldedPrefix.MatchString(p.folded)
+	}
+
+	fields := []string{strings.ToLower(m.Name), strings.ToLower(p.folded), strings.ToLower(m.Description)}
+	for _, tag := range m.Tags {
+		fields = append(fields, strings.ToLower(strings.TrimPrefix(tag, "#")))
+	}
+	words := make(map[string]bool)
+	for _, field := range fields {
+		for _, word := range splitWords(field) {
+			words[word] = true
+		}
+	}
+	found := func(part string) bool {
+		if strings.Contains(part, " ") {
+			return slices.ContainsFunc(fields, func(field string) bool { return strings.Contains(field, part) })
+		}
+		partWords := splitWords(part)
+		return len(partWords) > 0 && !slices.ContainsFunc(partWords, func(word string) bool { return !words[word] })
+	}
+
+	if len(s.terms) > 0 && !slices.ContainsFunc(s.terms, func(variants []string) bool {
+		return slices.ContainsFunc(variants, func(word string) bool { return words[word] })
+	}) {
+		return false
+	}
+	for _, phrase := range s.phrases {
+		if !slices.ContainsFunc(fields, func(field string) bool { return strings.Contains(field, phrase) }) {
+			return false
+		}
+	}
+	return !slices.ContainsFunc(s.excluded, found)
+}
+
+// splitWords returns the lowercased words of a text, which are runs of
+// letters and numbers.
+func splitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
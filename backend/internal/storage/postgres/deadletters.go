@@ -0,0 +1,152 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage/sqlstore"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/tracing"
+)
+
+// deadLetterColumns are the columns read by scanDeadLetter.
+const deadLetterColumns = `id, message, stage, error, attempts, created_at, updated_at`
+
+// DeadLetters stores messages that failed processing or persistence in the
+// dead_letters table of the database. It implements deadletter.Store.
+type DeadLetters struct {
+	pool *pgxpool.Pool // Connection pool of the database
+}
+
+// NewDeadLetters returns a dead-letter store in the same database as the posts.
+func (s *Store) NewDeadLetters() *DeadLetters {
+	return &DeadLetters{pool: s.pool}
+}
+
+// Record upserts the entry of a failed message, replacing the stored message,
+// stage and error with the latest ones and incrementing the attempt count.
+func (d *DeadLetters) Record(ctx context.Context, msg bot.Message, stage deadletter.Stage, failure error) (err error) {
+	// Finish the write even if the pipeline stage is being aborted
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "INSERT dead_letters")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = d.pool.Exec(ctx, `
+		INSERT INTO dead_letters (id, message, stage, error, attempts, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, 1, now(), now())
+		ON CONFLICT (id) DO UPDATE SET
+			message = excluded.message,
+			stage = excluded.stage,
+			error = excluded.error,
+			attempts = dead_letters.attempts + 1,
+			updated_at = excluded.updated_at`,
+		deadletter.EntryID(msg.ChatID, msg.MessageID), msg, string(stage), failure.Error(),
+	)
+	return err
+}
+
+// Resolve removes the entry of a message, if there is one.
+func (d *DeadLetters) Resolve(ctx context.Context, chatID int64, messageID int) (err error) {
+	// Finish the write even if the pipeline stage is being aborted
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "DELETE dead_letters")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = d.pool.Exec(ctx, `DELETE FROM dead_letters WHERE id = $1`, deadletter.EntryID(chatID, messageID))
+	return err
+}
+
+// List retrieves dead-letter entries with pagination, most recent failures first
+func (d *DeadLetters) List(ctx context.Context, page, limit int) (response deadletter.Page, err error) {
+	ctx, span := startSpan(ctx, "SELECT dead_letters")
+	defer func() { tracing.End(span, err) }()
+	defer sqlstore.LogQuery(ctx, "dead_letters", time.Now())
+
+	var total int64
+	if err := d.pool.QueryRow(ctx, `SELECT COUNT(*) FROM dead_letters`).Scan(&total); err != nil {
+		return deadletter.Page{}, err
+	}
+
+	// A NULL limit means no limit, like a limit of 0 in MongoDB
+	var limitArg any
+	if limit > 0 {
+		limitArg = limit
+	}
+	rows, err := d.pool.Query(ctx, `
+		SELECT `+deadLetterColumns+`
+		FROM dead_letters
+		ORDER BY updated_at DESC, id
+		LIMIT $1 OFFSET $2`,
+		limitArg, max(page-1, 0)*max(limit, 0),
+	)
+	if err != nil {
+		return deadletter.Page{}, err
+	}
+
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (deadletter.Entry, error) {
+		return scanDeadLetter(row)
+	})
+	if err != nil {
+		return deadletter.Page{}, err
+	}
+	if entries == nil {
+		entries = []deadletter.Entry{}
+	}
+
+	return deadletter.Page{Entries: entries, TotalCount: total}, nil
+}
+
+// Get retrieves a single dead-letter entry.
+// Returns deadletter.ErrNotFound if no such entry exists.
+func (d *DeadLetters) Get(ctx context.Context, id string) (entry deadletter.Entry, err error) {
+	ctx, span := startSpan(ctx, "SELECT dead_letters")
+	defer func() { tracing.End(span, sqlstore.IgnoreNotFound(err)) }()
+	defer sqlstore.LogQuery(ctx, "dead_letter", time.Now())
+
+	entry, err = scanDeadLetter(d.pool.QueryRow(ctx, `SELECT `+deadLetterColumns+` FROM dead_letters WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return deadletter.Entry{}, deadletter.ErrNotFound
+	}
+	return entry, err
+}
+
+// Delete discards a dead-letter entry.
+// Returns deadletter.ErrNotFound if no such entry exists.
+func (d *DeadLetters) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "DELETE dead_letters")
+	defer func() { tracing.End(span, sqlstore.IgnoreNotFound(err)) }()
+	defer sqlstore.LogQuery(ctx, "delete_dead_letter", time.Now())
+
+	tag, err := d.pool.Exec(ctx, `DELETE FROM dead_letters WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return deadletter.ErrNotFound
+	}
+
+	return nil
+}
+
+// scanDeadLetter reads an entry selected with deadLetterColumns.
+// The message is decoded from JSON by the driver.
+func scanDeadLetter(row pgx.Row) (deadletter.Entry, error) {
+	var entry deadletter.Entry
+	var stage string
+	if err := row.Scan(&entry.ID, &entry.Message, &stage, &entry.Error, &entry.Attempts, &entry.CreatedAt, &entry.UpdatedAt); err != nil {
+		return deadletter.Entry{}, err
+	}
+
+	entry.Stage = deadletter.Stage(stage)
+	entry.CreatedAt = entry.CreatedAt.UTC()
+	entry.UpdatedAt = entry.UpdatedAt.UTC()
+	return entry, nil
+}
@@ -0,0 +1,10 @@
+package postgres
+
+import "context"
+
+// Truncate deletes all posts and dead-letter entries, so that every test
+// starts with an empty database.
+func (s *Store) Truncate(ctx context.Context) error {
+	_, err := s.pool.Exec(ctx, `TRUNCATE posts, dead_letters RESTART IDENTITY`)
+	return err
+}
@@ -0,0 +1,158 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/translit"
+)
+
+// migrationLock is the key of the advisory lock held while a migration is
+// applied, so that processes starting together do not migrate twice.
+const migrationLock = 0x6b697269 // "kiri"
+
+// migrations are the schema changes applied in order to a new database.
+// Applied versions are recorded in the schema_migrations table, so existing
+// migrations must never change; append new ones instead.
+var migrations = []string{
+	// 1: posts with their tags in an array and a full-text index on names
+	`CREATE TABLE posts (
+		id          BIGSERIAL PRIMARY KEY,
+		chat_id     BIGINT NOT NULL,
+		message_id  BIGINT NOT NULL,
+		library     TEXT NOT NULL,
+		name        TEXT NOT NULL,
+		type        TEXT NOT NULL,
+		url         TEXT NOT NULL,
+		links       JSONB NOT NULL DEFAULT '[]',
+		attachment  JSONB, -- NULL for text posts
+		tags        TEXT[] NOT NULL DEFAULT '{}',
+		timestamp   TIMESTAMPTZ NOT NULL,
+		ingested_at TIMESTAMPTZ NOT NULL,
+		name_search TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', name)) STORED,
+		UNIQUE (chat_id, message_id)
+	);
+	CREATE INDEX posts_timestamp ON posts (timestamp DESC, id DESC);
+	CREATE INDEX posts_library_timestamp ON posts (library, timestamp DESC, id DESC);
+	CREATE INDEX posts_tags ON posts USING GIN (tags);
+	CREATE INDEX posts_name_search ON posts USING GIN (name_search);`,
+	// 2: optional descriptions of posts
+	`ALTER TABLE posts ADD COLUMN description TEXT NOT NULL DEFAULT '';`,
+	// 3: folded names, searched together with names; filled in by fillFoldedNames
+	`ALTER TABLE posts ADD COLUMN name_translit TEXT;
+	ALTER TABLE posts DROP COLUMN name_search;
+	ALTER TABLE posts ADD COLUMN name_search TSVECTOR
+		GENERATED ALWAYS AS (to_tsvector('simple', name || ' ' || coalesce(name_translit, ''))) STORED;
+	CREATE INDEX posts_name_search ON posts USING GIN (name_search);`,
+	// 4: entries of messages that failed processing or persistence
+	`CREATE TABLE dead_letters (
+		id         TEXT PRIMARY KEY, -- See deadletter.EntryID
+		message    JSONB NOT NULL,   -- Raw message
+		stage      TEXT NOT NULL,
+		error      TEXT NOT NULL,
+		attempts   INTEGER NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL
+	);
+	CREATE INDEX dead_letters_updated_at ON dead_letters (updated_at DESC, id);`,
+}
+
+// migrate applies the migrations the database has not seen yet, each in its
+// own transaction. Returns an error if a migration fails or the database was
+// created by a newer version.
+func migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	_, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var version int
+	if err := pool.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than the latest known version %d", version, len(migrations))
+	}
+
+	for ; version < len(migrations); version++ {
+		applied, err := apply(ctx, pool, version+1, migrations[version])
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", version+1, err)
+		}
+		if applied {
+			slog.Info("Applied Postgres migration", "version", version+1)
+		}
+	}
+
+	return fillFoldedNames(ctx, pool)
+}
+
+// fillFoldedNames stores the folded names of the posts saved before names
+// were folded. Names are folded in Go, so this cannot be part of a migration.
+func fillFoldedNames(ctx context.Context, pool *pgxpool.Pool) error {
+	rows, err := pool.Query(ctx, `SELECT id, name FROM posts WHERE name_translit IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to read names to fold: %w", err)
+	}
+	type post struct {
+		ID   int64
+		Name string
+	}
+	posts, err := pgx.CollectRows(rows, pgx.RowToStructByPos[post])
+	if err != nil {
+		return fmt.Errorf("failed to read names to fold: %w", err)
+	}
+	if len(posts) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, p := range posts {
+		batch.Queue(`UPDATE posts SET name_translit = $1 WHERE id = $2`, translit.Fold(p.Name), p.ID)
+	}
+	if err := pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to store folded names: %w", err)
+	}
+
+	slog.Info("Folded the names of stored posts", "posts", len(posts))
+	return nil
+}
+
+// apply runs a migration and records its version atomically, unless another
+// process applied it first. Reports whether the migration was applied.
+func apply(ctx context.Context, pool *pgxpool.Pool, version int, migration string) (bool, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// The lock is released when the transaction ends
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLock); err != nil {
+		return false, err
+	}
+
+	var applied bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied); err != nil {
+		return false, err
+	}
+	if applied {
+		return false, nil
+	}
+
+	// Without arguments, the statements of the migration are sent together
+	if _, err := tx.Exec(ctx, migration); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
@@ -0,0 +1,382 @@
+// Package postgres provides a PostgreSQL implementation of storage.Store for
+// deployments that run Postgres instead of MongoDB.
+// Post names are searched, together with their folded forms for transliterated
+// queries, through a tsvector column with a GIN index and tags are kept in an
+// indexed array; the schema is migrated when the store is opened.
+//
+// To try it against a local server, create a database and point the storage
+// DSN at it, e.g. STORAGE_DSN=postgres://postgres@localhost:5432/kirinyoku?sslmode=disable
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage/sqlstore"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/tracing"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/translit"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of database operations.
+var tracer = otel.Tracer("github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage/postgres")
+
+// postColumns are the columns read by scanPost, for a posts table aliased as p.
+const postColumns = `p.chat_id, p.message_id, p.library, p.name, p.type, p.description, p.url, p.links, p.attachment, p.tags, p.timestamp, p.ingested_at`
+
+// untaggedTag is a tag unnested as t(tag) without its "#" prefix, so that
+// tags with and without the prefix are counted as one.
+const untaggedTag = `(CASE WHEN left(t.tag, 1) = '#' THEN substr(t.tag, 2) ELSE t.tag END)`
+
+// Store keeps posts in a PostgreSQL database. It implements storage.Store.
+type Store struct {
+	pool *pgxpool.Pool // Connection pool of the database
+}
+
+// Open connects to the PostgreSQL database at dsn, a postgres:// URL or a
+// key=value connection string, and migrates its schema to the latest version.
+// Returns an error if the database cannot be reached or migrated.
+func Open(dsn string) (*Store, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to Postgres: %w", err)
+	}
+
+	if err := migrate(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return &Store{pool: pool}, nil
+}
+
+// SaveMessage inserts a post, or replaces the stored fields and tags of the
+// post with the same chat and message IDs while keeping its ingestion time.
+func (s *Store) SaveMessage(ctx context.Context, message processor.ProcessedMessage) (err error) {
+	ctx, span := startSpan(ctx, "INSERT posts")
+	defer func() { tracing.End(span, err) }()
+
+	links, tags := message.Links, message.Tags
+	if links == nil {
+		links = []processor.Link{}
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+
+	_, err = s.pool.Exec(ctx, `
+		INSERT INTO posts (chat_id, message_id, library, name, name_translit, type, description, url, links, attachment, tags, timestamp, ingested_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, now())
+		ON CONFLICT (chat_id, message_id) DO UPDATE SET
+			library = excluded.library,
+			name = excluded.name,
+			name_translit = excluded.name_translit,
+			type = excluded.type,
+			description = excluded.description,
+			url = excluded.url,
+			links = excluded.links,
+			attachment = excluded.attachment,
+			tags = excluded.tags,
+			timestamp = excluded.timestamp`,
+		message.ChatID, message.MessageID, message.Library, message.Name, translit.Fold(message.Name), message.Type, message.Description, message.URL,
+		links, message.Attachment, tags, message.Timestamp,
+	)
+	return err
+}
+
+// GetPostsWithFilters retrieves posts with specified filters and pagination,
+// ordered from the newest to the oldest Telegram post.
+// query is matched against the words of post names with the full-text index:
+// every word of the query must start a word of the name, case-insensitively,
+// or be a transliteration or wrong-layout spelling of one (see tsQuery).
+// language matches the last tag of a post exactly, which is its language
+// (see GetLanguages).
+func (s *Store) GetPostsWithFilters(ctx context.Context, query, tag, postType, language, library string, page, limit int) (response storage.PostsResponse, err error) {
+	ctx, span := startSpan(ctx, "SELECT posts")
+	defer func() { tracing.End(span, err) }()
+	defer sqlstore.LogQuery(ctx, "posts", time.Now())
+
+	conditions, args := filterConditions(query, tag, postType, language, library)
+	where := sqlstore.WhereClause(conditions...)
+
+	var total int64
+	if err := s.pool.QueryRow(ctx, "SELECT COUNT(*) FROM posts p "+where, args...).Scan(&total); err != nil {
+		return storage.PostsResponse{}, err
+	}
+
+	// A NULL limit means no limit, like a limit of 0 in MongoDB
+	var limitArg any
+	if limit > 0 {
+		limitArg = limit
+	}
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+postColumns+`
+		FROM posts p `+where+`
+		ORDER BY p.timestamp DESC, p.id DESC
+		LIMIT `+fmt.Sprintf("$%d OFFSET $%d", len(args)+1, len(args)+2),
+		append(args, limitArg, max(page-1, 0)*max(limit, 0))...,
+	)
+	if err != nil {
+		return storage.PostsResponse{}, err
+	}
+	defer rows.Close()
+
+	var posts []processor.ProcessedMessage
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return storage.PostsResponse{}, err
+		}
+		for i, tag := range post.Tags {
+			post.Tags[i] = strings.TrimPrefix(tag, "#")
+		}
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return storage.PostsResponse{}, err
+	}
+
+	return storage.PostsResponse{Posts: posts, TotalCount: total}, nil
+}
+
+// GetPostsWithFacets is like GetPostsWithFilters, but also counts the types,
+// tags and languages of all matching posts.
+func (s *Store) GetPostsWithFacets(ctx context.Context, query, tag, postType, language, library string, page, limit int) (response storage.PostsResponse, err error) {
+	response, err = s.GetPostsWithFilters(ctx, query, tag, postType, language, library, page, limit)
+	if err != nil {
+		return storage.PostsResponse{}, err
+	}
+
+	ctx, span := startSpan(ctx, "SELECT posts")
+	defer func() { tracing.End(span, err) }()
+	defer sqlstore.LogQuery(ctx, "facets", time.Now())
+
+	conditions, args := filterConditions(query, tag, postType, language, library)
+	var facets storage.Facets
+	facets.Types, err = sqlstore.QueryCounts(ctx, s.query, `
+		SELECT p.type COLLATE "C", COUNT(*)
+		FROM posts p `+sqlstore.WhereClause(append(conditions, "p.type <> ''")...)+`
+		GROUP BY 1
+		ORDER BY 2 DESC, 1`,
+		args...,
+	)
+	if err != nil {
+		return storage.PostsResponse{}, err
+	}
+	facets.Tags, err = sqlstore.QueryCounts(ctx, s.query, `
+		SELECT `+untaggedTag+` COLLATE "C", COUNT(DISTINCT p.id)
+		FROM posts p, unnest(p.tags) AS t(tag) `+sqlstore.WhereClause(conditions...)+`
+		GROUP BY 1
+		ORDER BY 2 DESC, 1`,
+		args...,
+	)
+	if err != nil {
+		return storage.PostsResponse{}, err
+	}
+	// The language of a post is its last tag, if it consists of two lowercase letters
+	facets.Languages, err = sqlstore.QueryCounts(ctx, s.query, `
+		SELECT language COLLATE "C", COUNT(*)
+		FROM (SELECT p.tags[cardinality(p.tags)] AS language FROM posts p `+sqlstore.WhereClause(conditions...)+`) AS l
+		WHERE language ~ '^[a-z]{2}$'
+		GROUP BY 1
+		ORDER BY 2 DESC, 1`,
+		args...,
+	)
+	if err != nil {
+		return storage.PostsResponse{}, err
+	}
+
+	response.Facets = &facets
+	return response, nil
+}
+
+// filterConditions returns the conditions on posts, aliased as p, that
+// implement the filters of GetPostsWithFilters, and their arguments.
+func filterConditions(query, tag, postType, language, library string) ([]string, []any) {
+	var conditions []string
+	var args []any
+	// arg adds a query argument and returns its placeholder
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if library != "" {
+		conditions = append(conditions, "p.library = "+arg(library))
+	}
+	if query != "" {
+		if expression := tsQuery(query); expression != "" {
+			conditions = append(conditions, "p.name_search @@ to_tsquery('simple', "+arg(expression)+")")
+		} else {
+			// A query consisting only of separators matches nothing
+			conditions = append(conditions, "FALSE")
+		}
+	}
+	if postType != "" {
+		conditions = append(conditions, "p.type = "+arg(postType))
+	}
+	if tag != "" {
+		conditions = append(conditions, "p.tags @> ARRAY["+arg(tag)+"::text]")
+	}
+	if language != "" {
+		conditions = append(conditions, "p.tags[cardinality(p.tags)] = "+arg(language))
+	}
+	return conditions, args
+}
+
+// GetPost retrieves the post stored for a Telegram message.
+// Returns storage.ErrNotFound if no such post exists.
+func (s *Store) GetPost(ctx context.Context, chatID int64, messageID int) (post processor.ProcessedMessage, err error) {
+	ctx, span := startSpan(ctx, "SELECT posts")
+	defer func() { tracing.End(span, sqlstore.IgnoreNotFound(err)) }()
+	defer sqlstore.LogQuery(ctx, "post", time.Now())
+
+	row := s.pool.QueryRow(ctx, `
+		SELECT `+postColumns+`
+		FROM posts p
+		WHERE p.chat_id = $1 AND p.message_id = $2`,
+		chatID, messageID,
+	)
+
+	post, err = scanPost(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return processor.ProcessedMessage{}, storage.ErrNotFound
+	}
+	return post, err
+}
+
+// GetTags retrieves all unique tags, limited to the posts of one library
+// unless library is empty
+func (s *Store) GetTags(ctx context.Context, library string) (tags []string, err error) {
+	ctx, span := startSpan(ctx, "SELECT posts")
+	defer func() { tracing.End(span, err) }()
+	defer sqlstore.LogQuery(ctx, "tags", time.Now())
+
+	// Tags are compared byte-wise, like in MongoDB
+	return sqlstore.QueryStrings(ctx, s.query, `
+		SELECT DISTINCT `+untaggedTag+` COLLATE "C"
+		FROM posts p, unnest(p.tags) AS t(tag)
+		WHERE $1 = '' OR p.library = $1
+		ORDER BY 1`,
+		library,
+	)
+}
+
+// GetLanguages retrieves all unique language codes from tags, limited to the
+// posts of one library unless library is empty
+func (s *Store) GetLanguages(ctx context.Context, library string) (languages []string, err error) {
+	ctx, span := startSpan(ctx, "SELECT posts")
+	defer func() { tracing.End(span, err) }()
+	defer sqlstore.LogQuery(ctx, "languages", time.Now())
+
+	// The language of a post is its last tag, if it consists of two lowercase letters
+	return sqlstore.QueryStrings(ctx, s.query, `
+		SELECT DISTINCT language COLLATE "C"
+		FROM (SELECT p.tags[cardinality(p.tags)] AS language FROM posts p WHERE $1 = '' OR p.library = $1) AS l
+		WHERE language ~ '^[a-z]{2}$'
+		ORDER BY 1`,
+		library,
+	)
+}
+
+// GetLibraries retrieves the identifiers of all libraries that have posts
+func (s *Store) GetLibraries(ctx context.Context) (libraries []string, err error) {
+	ctx, span := startSpan(ctx, "SELECT posts")
+	defer func() { tracing.End(span, err) }()
+	defer sqlstore.LogQuery(ctx, "libraries", time.Now())
+
+	return sqlstore.QueryStrings(ctx, s.query, `SELECT DISTINCT library COLLATE "C" FROM posts WHERE library <> '' ORDER BY 1`)
+}
+
+// Ping verifies that the database can be reached.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
+// Close closes the connections of the pool.
+func (s *Store) Close() error {
+	s.pool.Close()
+	return nil
+}
+
+// query runs a query, see sqlstore.QueryFunc.
+func (s *Store) query(ctx context.Context, query string, args ...any) (sqlstore.Rows, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// scanPost reads a post selected with postColumns.
+// Links and attachments are decoded from JSON by the driver.
+func scanPost(row pgx.Row) (processor.ProcessedMessage, error) {
+	var post processor.ProcessedMessage
+	err := row.Scan(&post.ChatID, &post.MessageID, &post.Library, &post.Name, &post.Type, &post.Description, &post.URL,
+		&post.Links, &post.Attachment, &post.Tags, &post.Timestamp, &post.IngestedAt)
+	if err != nil {
+		return processor.ProcessedMessage{}, err
+	}
+
+	post.Timestamp = post.Timestamp.UTC()
+	post.IngestedAt = post.IngestedAt.UTC()
+	return post, nil
+}
+
+// tsQuery turns a search query into a tsquery requiring every word of the
+// query, or one of its variants, as a prefix of a word of the name or of the
+// folded name (see translit.Variants), or returns "" if the query has no
+// words. Words are quoted, so tsquery operators in the query are matched
+// literally.
+func tsQuery(query string) string {
+	var groups []string
+	for _, variants := range translit.Query(query) {
+		if len(sqlstore.Words(variants[0])) == 0 {
+			// Separators between words are ignored
+			continue
+		}
+
+		var alternatives []string
+		for _, variant := range variants {
+			terms := sqlstore.Words(variant)
+			if len(terms) == 0 {
+				continue
+			}
+			for i, term := range terms {
+				terms[i] = "'" + term + "':*"
+			}
+			alternatives = append(alternatives, "("+strings.Join(terms, " & ")+")")
+		}
+		groups = append(groups, "("+strings.Join(alternatives, " | ")+")")
+	}
+
+	return strings.Join(groups, " & ")
+}
+
+// startSpan starts a client span for a query, named after its operation and table.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	operation, table, _ := strings.Cut(name, " ")
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation.name", operation),
+		attribute.String("db.collection.name", table),
+	))
+}
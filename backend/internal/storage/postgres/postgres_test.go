@@ -0,0 +1,53 @@
+package postgres_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter/deadlettertest"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage/postgres"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage/storagetest"
+)
+
+// dsnVariable names the environment variable holding the DSN of the
+// database the tests run against, e.g.
+// postgres://postgres@localhost:5432/kirinyoku_test?sslmode=disable.
+// The tests are skipped if it is not set. The database must be a scratch
+// database: the tests empty its tables.
+const dsnVariable = "POSTGRES_TEST_DSN"
+
+// openStore opens the test database with empty tables, closed when the test
+// ends, or skips the test if no test database is configured.
+func openStore(t *testing.T) *postgres.Store {
+	t.Helper()
+	dsn := os.Getenv(dsnVariable)
+	if dsn == "" {
+		t.Skipf("%s is not set", dsnVariable)
+	}
+
+	store, err := postgres.Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	if err := store.Truncate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		return openStore(t)
+	})
+}
+
+func TestDeadLetters(t *testing.T) {
+	deadlettertest.Run(t, func(t *testing.T) deadletter.Store {
+		return openStore(t).NewDeadLetters()
+	})
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SearchQuery is a search query split into the parts stores match: words,
+// "quoted phrases" and -excluded words or phrases, as understood by the
+// MongoDB $text operator. Queries are parsed here rather than by each store,
+// so that the memory store matches the same queries as the MongoDB store.
+type SearchQuery struct {
+	Terms    []string // Words of which at least one must match
+	Phrases  []string // Quoted phrases that must all match
+	Excluded []string // Words or phrases prefixed with "-" that must not match
+}
+
+// ParseSearch splits a search query into words, "quoted phrases" and
+// -excluded words or phrases. An unterminated phrase extends to the end of
+// the query. Backslashes are dropped, so they cannot escape the quotes
+// added when the query is rendered again.
+func ParseSearch(query string) SearchQuery {
+	var search SearchQuery
+	rest := strings.ReplaceAll(query, `\`, " ")
+
+	for {
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		if rest == "" {
+			return search
+		}
+
+		excluded := false
+		if strings.HasPrefix(rest, "-") {
+			excluded = true
+			rest = rest[1:]
+		}
+
+		var part string
+		if strings.HasPrefix(rest, `"`) {
+			part, rest, _ = strings.Cut(rest[1:], `"`)
+			part = strings.Join(strings.Fields(part), " ")
+			if part == "" {
+				continue
+			}
+			if !excluded {
+				search.Phrases = append(search.Phrases, part)
+				continue
+			}
+		} else {
+			end := strings.IndexFunc(rest, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+			if end < 0 {
+				end = len(rest)
+			}
+			part, rest = rest[:end], rest[end:]
+			if part == "" {
+				continue
+			}
+			if !excluded {
+				search.Terms = append(search.Terms, part)
+				continue
+			}
+		}
+
+		search.Excluded = append(search.Excluded, part)
+	}
+}
+
+// Empty reports whether the query has nothing to search for.
+func (q SearchQuery) Empty() bool {
+	return len(q.Terms) == 0 && len(q.Phrases) == 0 && len(q.Excluded) == 0
+}
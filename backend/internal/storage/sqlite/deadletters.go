@@ -0,0 +1,173 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage/sqlstore"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/tracing"
+)
+
+// DeadLetters stores messages that failed processing or persistence in the
+// dead_letters table of the database. It implements deadletter.Store.
+type DeadLetters struct {
+	db *sql.DB // Connection pool of the database file
+}
+
+// NewDeadLetters returns a dead-letter store in the same database as the posts.
+func (s *Store) NewDeadLetters() *DeadLetters {
+	return &DeadLetters{db: s.db}
+}
+
+// Record upserts the entry of a failed message, replacing the stored message,
+// stage and error with the latest ones and incrementing the attempt count.
+func (d *DeadLetters) Record(ctx context.Context, msg bot.Message, stage deadletter.Stage, failure error) (err error) {
+	// Finish the write even if the pipeline stage is being aborted
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "upsert dead_letters")
+	defer func() { tracing.End(span, err) }()
+
+	message, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UnixMilli()
+	_, err = d.db.ExecContext(ctx, `
+		INSERT INTO dead_letters (id, message, stage, error, attempts, created_at, updated_at)
+		VALUES (?, ?, ?, ?, 1, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			message = excluded.message,
+			stage = excluded.stage,
+			error = excluded.error,
+			attempts = attempts + 1,
+			updated_at = excluded.updated_at`,
+		deadletter.EntryID(msg.ChatID, msg.MessageID), string(message), string(stage), failure.Error(), now, now,
+	)
+	return err
+}
+
+// Resolve removes the entry of a message, if there is one.
+func (d *DeadLetters) Resolve(ctx context.Context, chatID int64, messageID int) (err error) {
+	// Finish the write even if the pipeline stage is being aborted
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "delete dead_letters")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = d.db.ExecContext(ctx, `DELETE FROM dead_letters WHERE id = ?`, deadletter.EntryID(chatID, messageID))
+	return err
+}
+
+// List retrieves dead-letter entries with pagination, most recent failures first
+func (d *DeadLetters) List(ctx context.Context, page, limit int) (response deadletter.Page, err error) {
+	ctx, span := startSpan(ctx, "select dead_letters")
+	defer func() { tracing.End(span, err) }()
+	defer sqlstore.LogQuery(ctx, "dead_letters", time.Now())
+
+	var total int64
+	if err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM dead_letters`).Scan(&total); err != nil {
+		return deadletter.Page{}, err
+	}
+
+	// A negative limit means no limit in SQLite, like a limit of 0 in MongoDB
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT id, message, stage, error, attempts, created_at, updated_at
+		FROM dead_letters
+		ORDER BY updated_at DESC, id
+		LIMIT ? OFFSET ?`,
+		limit, max(page-1, 0)*max(limit, 0),
+	)
+	if err != nil {
+		return deadletter.Page{}, err
+	}
+	defer rows.Close()
+
+	entries := []deadletter.Entry{}
+	for rows.Next() {
+		entry, err := scanDeadLetter(rows)
+		if err != nil {
+			return deadletter.Page{}, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return deadletter.Page{}, err
+	}
+
+	return deadletter.Page{Entries: entries, TotalCount: total}, nil
+}
+
+// Get retrieves a single dead-letter entry.
+// Returns deadletter.ErrNotFound if no such entry exists.
+func (d *DeadLetters) Get(ctx context.Context, id string) (entry deadletter.Entry, err error) {
+	ctx, span := startSpan(ctx, "select dead_letter")
+	defer func() { tracing.End(span, sqlstore.IgnoreNotFound(err)) }()
+	defer sqlstore.LogQuery(ctx, "dead_letter", time.Now())
+
+	row := d.db.QueryRowContext(ctx, `
+		SELECT id, message, stage, error, attempts, created_at, updated_at
+		FROM dead_letters
+		WHERE id = ?`,
+		id,
+	)
+
+	entry, err = scanDeadLetter(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return deadletter.Entry{}, deadletter.ErrNotFound
+	}
+	return entry, err
+}
+
+// Delete discards a dead-letter entry.
+// Returns deadletter.ErrNotFound if no such entry exists.
+func (d *DeadLetters) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "delete dead_letter")
+	defer func() { tracing.End(span, sqlstore.IgnoreNotFound(err)) }()
+	defer sqlstore.LogQuery(ctx, "delete_dead_letter", time.Now())
+
+	result, err := d.db.ExecContext(ctx, `DELETE FROM dead_letters WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return deadletter.ErrNotFound
+	}
+
+	return nil
+}
+
+// scanDeadLetter reads a dead-letter entry selected with its JSON-encoded message.
+func scanDeadLetter(row interface{ Scan(...any) error }) (deadletter.Entry, error) {
+	var entry deadletter.Entry
+	var message string
+	var createdAt, updatedAt int64
+
+	if err := row.Scan(&entry.ID, &message, &entry.Stage, &entry.Error, &entry.Attempts, &createdAt, &updatedAt); err != nil {
+		return deadletter.Entry{}, err
+	}
+
+	if err := json.Unmarshal([]byte(message), &entry.Message); err != nil {
+		return deadletter.Entry{}, fmt.Errorf("invalid message of dead letter %s: %w", entry.ID, err)
+	}
+	entry.CreatedAt = time.UnixMilli(createdAt).UTC()
+	entry.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+
+	return entry, nil
+}
@@ -0,0 +1,14 @@
+package sqlite_test
+
+import (
+	"testing"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter/deadlettertest"
+)
+
+func TestDeadLetters(t *testing.T) {
+	deadlettertest.Run(t, func(t *testing.T) deadletter.Store {
+		return openStore(t).NewDeadLetters()
+	})
+}
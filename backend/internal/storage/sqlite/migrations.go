@@ -0,0 +1,183 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/translit"
+)
+
+// migrations are the schema changes applied in order to a new database.
+// The number of applied migrations is kept in the user_version pragma, so
+// existing migrations must never change; append new ones instead.
+var migrations = []string{
+	// 1: posts with their tags in a join table and an FTS5 index on names
+	`CREATE TABLE posts (
+		id          INTEGER PRIMARY KEY,
+		chat_id     INTEGER NOT NULL,
+		message_id  INTEGER NOT NULL,
+		library     TEXT NOT NULL,
+		name        TEXT NOT NULL,
+		type        TEXT NOT NULL,
+		url         TEXT NOT NULL,
+		links       TEXT NOT NULL DEFAULT '[]', -- JSON array of links
+		attachment  TEXT,                       -- JSON object, NULL for text posts
+		timestamp   INTEGER NOT NULL,           -- Unix milliseconds
+		ingested_at INTEGER NOT NULL,           -- Unix milliseconds
+		UNIQUE (chat_id, message_id)
+	);
+	CREATE INDEX posts_timestamp ON posts (timestamp DESC, id DESC);
+	CREATE INDEX posts_library_timestamp ON posts (library, timestamp DESC, id DESC);
+
+	CREATE TABLE post_tags (
+		post_id  INTEGER NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		tag      TEXT NOT NULL,
+		PRIMARY KEY (post_id, position)
+	);
+	CREATE INDEX post_tags_tag ON post_tags (tag);
+
+	CREATE VIRTUAL TABLE posts_fts USING fts5(
+		name,
+		content = 'posts',
+		content_rowid = 'id',
+		tokenize = 'unicode61 remove_diacritics 2'
+	);
+	CREATE TRIGGER posts_fts_insert AFTER INSERT ON posts BEGIN
+		INSERT INTO posts_fts (rowid, name) VALUES (new.id, new.name);
+	END;
+	CREATE TRIGGER posts_fts_delete AFTER DELETE ON posts BEGIN
+		INSERT INTO posts_fts (posts_fts, rowid, name) VALUES ('delete', old.id, old.name);
+	END;
+	CREATE TRIGGER posts_fts_update AFTER UPDATE OF name ON posts BEGIN
+		INSERT INTO posts_fts (posts_fts, rowid, name) VALUES ('delete', old.id, old.name);
+		INSERT INTO posts_fts (rowid, name) VALUES (new.id, new.name);
+	END;`,
+	// 2: optional descriptions of posts
+	`ALTER TABLE posts ADD COLUMN description TEXT NOT NULL DEFAULT '';`,
+	// 3: folded names, searched together with names; filled in by fillFoldedNames
+	`ALTER TABLE posts ADD COLUMN name_translit TEXT;
+
+	DROP TRIGGER posts_fts_insert;
+	DROP TRIGGER posts_fts_delete;
+	DROP TRIGGER posts_fts_update;
+	DROP TABLE posts_fts;
+
+	CREATE VIRTUAL TABLE posts_fts USING fts5(
+		name,
+		name_translit,
+		content = 'posts',
+		content_rowid = 'id',
+		tokenize = 'unicode61 remove_diacritics 2'
+	);
+	CREATE TRIGGER posts_fts_insert AFTER INSERT ON posts BEGIN
+		INSERT INTO posts_fts (rowid, name, name_translit) VALUES (new.id, new.name, new.name_translit);
+	END;
+	CREATE TRIGGER posts_fts_delete AFTER DELETE ON posts BEGIN
+		INSERT INTO posts_fts (posts_fts, rowid, name, name_translit) VALUES ('delete', old.id, old.name, old.name_translit);
+	END;
+	CREATE TRIGGER posts_fts_update AFTER UPDATE OF name, name_translit ON posts BEGIN
+		INSERT INTO posts_fts (posts_fts, rowid, name, name_translit) VALUES ('delete', old.id, old.name, old.name_translit);
+		INSERT INTO posts_fts (rowid, name, name_translit) VALUES (new.id, new.name, new.name_translit);
+	END;
+	INSERT INTO posts_fts (posts_fts) VALUES ('rebuild');`,
+	// 4: entries of messages that failed processing or persistence
+	`CREATE TABLE dead_letters (
+		id         TEXT PRIMARY KEY,  -- See deadletter.EntryID
+		message    TEXT NOT NULL,     -- JSON object of the raw message
+		stage      TEXT NOT NULL,
+		error      TEXT NOT NULL,
+		attempts   INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,  -- Unix milliseconds
+		updated_at INTEGER NOT NULL   -- Unix milliseconds
+	);
+	CREATE INDEX dead_letters_updated_at ON dead_letters (updated_at DESC, id);`,
+}
+
+// migrate applies the migrations the database has not seen yet, each in its
+// own transaction. Returns an error if a migration fails or the database was
+// created by a newer version.
+func migrate(ctx context.Context, db *sql.DB) error {
+	var version int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than the latest known version %d", version, len(migrations))
+	}
+
+	for ; version < len(migrations); version++ {
+		if err := apply(ctx, db, version+1, migrations[version]); err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", version+1, err)
+		}
+		slog.Info("Applied SQLite migration", "version", version+1)
+	}
+
+	return fillFoldedNames(ctx, db)
+}
+
+// fillFoldedNames stores the folded names of the posts saved before names
+// were folded. Names are folded in Go, so this cannot be part of a migration.
+func fillFoldedNames(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT id, name FROM posts WHERE name_translit IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to read names to fold: %w", err)
+	}
+	names := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read names to fold: %w", err)
+		}
+		names[id] = name
+	}
+	// The rows must be closed before writing, since the pool has a single connection
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read names to fold: %w", err)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for id, name := range names {
+		if _, err := tx.ExecContext(ctx, `UPDATE posts SET name_translit = ? WHERE id = ?`, translit.Fold(name), id); err != nil {
+			return fmt.Errorf("failed to store folded names: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to store folded names: %w", err)
+	}
+
+	slog.Info("Folded the names of stored posts", "posts", len(names))
+	return nil
+}
+
+// apply runs a migration and records the new schema version atomically.
+func apply(ctx context.Context, db *sql.DB, version int, migration string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		return err
+	}
+	// Pragmas take no parameters; version is an integer
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,439 @@
+// Package sqlite provides an embedded SQLite implementation of storage.Store,
+// so that small deployments can run without a MongoDB server.
+// Post names are searched with an FTS5 index, together with their folded
+// forms for transliterated queries, and tags are kept in a join table; the
+// schema is migrated when the database is opened.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage/sqlstore"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/tracing"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/translit"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	_ "modernc.org/sqlite" // Registers the "sqlite" driver
+)
+
+// tracer creates the spans of database operations.
+var tracer = otel.Tracer("github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage/sqlite")
+
+// untaggedTag is a tag of the post_tags table aliased as t without its "#"
+// prefix, so that tags with and without the prefix are counted as one.
+const untaggedTag = `CASE WHEN t.tag GLOB '#*' THEN substr(t.tag, 2) ELSE t.tag END`
+
+// Store keeps posts in an SQLite database file. It implements storage.Store.
+type Store struct {
+	db *sql.DB // Connection pool of the database file
+}
+
+// Open opens the SQLite database at path, creating the file and its
+// directory if needed, and migrates its schema to the latest version.
+// Returns an error if the database cannot be opened or migrated.
+func Open(path string) (*Store, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+	}
+
+	// Write-ahead logging lets readers proceed while a post is saved;
+	// foreign keys remove the tags of deleted posts
+	dsn := "file:" + path + "?_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; one connection avoids busy errors
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// SaveMessage inserts a post, or replaces the stored fields and tags of the
+// post with the same chat and message IDs while keeping its ingestion time.
+func (s *Store) SaveMessage(ctx context.Context, message processor.ProcessedMessage) (err error) {
+	ctx, span := startSpan(ctx, "upsert posts")
+	defer func() { tracing.End(span, err) }()
+
+	links, err := json.Marshal(message.Links)
+	if err != nil {
+		return err
+	}
+	var attachment []byte
+	if message.Attachment != nil {
+		if attachment, err = json.Marshal(message.Attachment); err != nil {
+			return err
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO posts (chat_id, message_id, library, name, name_translit, type, description, url, links, attachment, timestamp, ingested_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat_id, message_id) DO UPDATE SET
+			library = excluded.library,
+			name = excluded.name,
+			name_translit = excluded.name_translit,
+			type = excluded.type,
+			description = excluded.description,
+			url = excluded.url,
+			links = excluded.links,
+			attachment = excluded.attachment,
+			timestamp = excluded.timestamp
+		RETURNING id`,
+		message.ChatID, message.MessageID, message.Library, message.Name, translit.Fold(message.Name), message.Type, message.Description, message.URL,
+		string(links), nullString(attachment), message.Timestamp.UnixMilli(), time.Now().UnixMilli(),
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post_tags WHERE post_id = ?`, id); err != nil {
+		return err
+	}
+	for position, tag := range message.Tags {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO post_tags (post_id, position, tag) VALUES (?, ?, ?)`, id, position, tag); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetPostsWithFilters retrieves posts with specified filters and pagination,
+// ordered from the newest to the oldest Telegram post.
+// query is matched against the words of post names with the FTS5 index:
+// every word of the query must start a word of the name, case-insensitively,
+// or be a transliteration or wrong-layout spelling of one (see matchExpression).
+func (s *Store) GetPostsWithFilters(ctx context.Context, query, tag, postType, language, library string, page, limit int) (response storage.PostsResponse, err error) {
+	ctx, span := startSpan(ctx, "select posts")
+	defer func() { tracing.End(span, err) }()
+	defer sqlstore.LogQuery(ctx, "posts", time.Now())
+
+	conditions, args := filterConditions(query, tag, postType, language, library)
+	where := sqlstore.WhereClause(conditions...)
+
+	var total int64
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts p "+where, args...).Scan(&total); err != nil {
+		return storage.PostsResponse{}, err
+	}
+
+	// A negative limit means no limit in SQLite, like a limit of 0 in MongoDB
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.chat_id, p.message_id, p.library, p.name, p.type, p.description, p.url, p.links, p.attachment, p.timestamp, p.ingested_at,
+			(SELECT json_group_array(tag) FROM (SELECT tag FROM post_tags WHERE post_id = p.id ORDER BY position))
+		FROM posts p `+where+`
+		ORDER BY p.timestamp DESC, p.id DESC
+		LIMIT ? OFFSET ?`,
+		append(args, limit, max(page-1, 0)*max(limit, 0))...,
+	)
+	if err != nil {
+		return storage.PostsResponse{}, err
+	}
+	defer rows.Close()
+
+	var posts []processor.ProcessedMessage
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return storage.PostsResponse{}, err
+		}
+		for i, tag := range post.Tags {
+			post.Tags[i] = strings.TrimPrefix(tag, "#")
+		}
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return storage.PostsResponse{}, err
+	}
+
+	return storage.PostsResponse{Posts: posts, TotalCount: total}, nil
+}
+
+// GetPostsWithFacets is like GetPostsWithFilters, but also counts the types,
+// tags and languages of all matching posts.
+func (s *Store) GetPostsWithFacets(ctx context.Context, query, tag, postType, language, library string, page, limit int) (response storage.PostsResponse, err error) {
+	response, err = s.GetPostsWithFilters(ctx, query, tag, postType, language, library, page, limit)
+	if err != nil {
+		return storage.PostsResponse{}, err
+	}
+
+	ctx, span := startSpan(ctx, "select facets")
+	defer func() { tracing.End(span, err) }()
+	defer sqlstore.LogQuery(ctx, "facets", time.Now())
+
+	conditions, args := filterConditions(query, tag, postType, language, library)
+	var facets storage.Facets
+	facets.Types, err = sqlstore.QueryCounts(ctx, s.query, `
+		SELECT p.type, COUNT(*)
+		FROM posts p `+sqlstore.WhereClause(append(conditions, "p.type != ''")...)+`
+		GROUP BY p.type
+		ORDER BY 2 DESC, 1`,
+		args...,
+	)
+	if err != nil {
+		return storage.PostsResponse{}, err
+	}
+	facets.Tags, err = sqlstore.QueryCounts(ctx, s.query, `
+		SELECT `+untaggedTag+`, COUNT(DISTINCT p.id)
+		FROM posts p JOIN post_tags t ON t.post_id = p.id `+sqlstore.WhereClause(conditions...)+`
+		GROUP BY 1
+		ORDER BY 2 DESC, 1`,
+		args...,
+	)
+	if err != nil {
+		return storage.PostsResponse{}, err
+	}
+	// The language of a post is its last tag, if it consists of two lowercase letters
+	languageConditions := append(conditions,
+		"pt.position = (SELECT MAX(position) FROM post_tags WHERE post_id = p.id)",
+		"pt.tag GLOB '[a-z][a-z]'",
+	)
+	facets.Languages, err = sqlstore.QueryCounts(ctx, s.query, `
+		SELECT pt.tag, COUNT(*)
+		FROM posts p JOIN post_tags pt ON pt.post_id = p.id `+sqlstore.WhereClause(languageConditions...)+`
+		GROUP BY pt.tag
+		ORDER BY 2 DESC, 1`,
+		args...,
+	)
+	if err != nil {
+		return storage.PostsResponse{}, err
+	}
+
+	response.Facets = &facets
+	return response, nil
+}
+
+// filterConditions returns the conditions on posts, aliased as p, that
+// implement the filters of GetPostsWithFilters, and their arguments.
+func filterConditions(query, tag, postType, language, library string) ([]string, []any) {
+	var conditions []string
+	var args []any
+	if library != "" {
+		conditions = append(conditions, "p.library = ?")
+		args = append(args, library)
+	}
+	if query != "" {
+		conditions = append(conditions, "p.id IN (SELECT rowid FROM posts_fts WHERE posts_fts MATCH ?)")
+		args = append(args, matchExpression(query))
+	}
+	if postType != "" {
+		conditions = append(conditions, "p.type = ?")
+		args = append(args, postType)
+	}
+	if tag != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM post_tags t WHERE t.post_id = p.id AND t.tag = ?)")
+		args = append(args, tag)
+	}
+	if language != "" {
+		// The language of a post is its last tag
+		conditions = append(conditions, "(SELECT tag FROM post_tags WHERE post_id = p.id ORDER BY position DESC LIMIT 1) = ?")
+		args = append(args, language)
+	}
+	return conditions, args
+}
+
+// GetPost retrieves the post stored for a Telegram message.
+// Returns storage.ErrNotFound if no such post exists.
+func (s *Store) GetPost(ctx context.Context, chatID int64, messageID int) (post processor.ProcessedMessage, err error) {
+	ctx, span := startSpan(ctx, "select post")
+	defer func() { tracing.End(span, sqlstore.IgnoreNotFound(err)) }()
+	defer sqlstore.LogQuery(ctx, "post", time.Now())
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT p.chat_id, p.message_id, p.library, p.name, p.type, p.description, p.url, p.links, p.attachment, p.timestamp, p.ingested_at,
+			(SELECT json_group_array(tag) FROM (SELECT tag FROM post_tags WHERE post_id = p.id ORDER BY position))
+		FROM posts p
+		WHERE p.chat_id = ? AND p.message_id = ?`,
+		chatID, messageID,
+	)
+
+	post, err = scanPost(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return processor.ProcessedMessage{}, storage.ErrNotFound
+	}
+	return post, err
+}
+
+// GetTags retrieves all unique tags, limited to the posts of one library
+// unless library is empty
+func (s *Store) GetTags(ctx context.Context, library string) (tags []string, err error) {
+	ctx, span := startSpan(ctx, "select tags")
+	defer func() { tracing.End(span, err) }()
+	defer sqlstore.LogQuery(ctx, "tags", time.Now())
+
+	return sqlstore.QueryStrings(ctx, s.query, `
+		SELECT DISTINCT `+untaggedTag+`
+		FROM post_tags t JOIN posts p ON p.id = t.post_id
+		WHERE ? = '' OR p.library = ?
+		ORDER BY 1`,
+		library, library,
+	)
+}
+
+// GetLanguages retrieves all unique language codes from tags, limited to the
+// posts of one library unless library is empty
+func (s *Store) GetLanguages(ctx context.Context, library string) (languages []string, err error) {
+	ctx, span := startSpan(ctx, "select languages")
+	defer func() { tracing.End(span, err) }()
+	defer sqlstore.LogQuery(ctx, "languages", time.Now())
+
+	// The language of a post is its last tag, if it consists of two lowercase letters
+	return sqlstore.QueryStrings(ctx, s.query, `
+		SELECT DISTINCT t.tag
+		FROM post_tags t JOIN posts p ON p.id = t.post_id
+		WHERE (? = '' OR p.library = ?)
+			AND t.position = (SELECT MAX(position) FROM post_tags WHERE post_id = t.post_id)
+			AND t.tag GLOB '[a-z][a-z]'
+		ORDER BY t.tag`,
+		library, library,
+	)
+}
+
+// GetLibraries retrieves the identifiers of all libraries that have posts
+func (s *Store) GetLibraries(ctx context.Context) (libraries []string, err error) {
+	ctx, span := startSpan(ctx, "select libraries")
+	defer func() { tracing.End(span, err) }()
+	defer sqlstore.LogQuery(ctx, "libraries", time.Now())
+
+	return sqlstore.QueryStrings(ctx, s.query, `SELECT DISTINCT library FROM posts WHERE library != '' ORDER BY library`)
+}
+
+// Ping verifies that the database can be queried.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// query runs a query, see sqlstore.QueryFunc.
+func (s *Store) query(ctx context.Context, query string, args ...any) (sqlstore.Rows, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return sqlRows{rows}, nil
+}
+
+// sqlRows adapts the rows of database/sql to sqlstore.Rows.
+type sqlRows struct {
+	*sql.Rows
+}
+
+// Close closes the rows; errors of reading them are reported by Err.
+func (r sqlRows) Close() {
+	r.Rows.Close()
+}
+
+// scanPost reads a post selected with its JSON-encoded links, attachment and tags.
+func scanPost(row interface{ Scan(...any) error }) (processor.ProcessedMessage, error) {
+	var post processor.ProcessedMessage
+	var links, tags string
+	var attachment sql.NullString
+	var timestamp, ingestedAt int64
+
+	err := row.Scan(&post.ChatID, &post.MessageID, &post.Library, &post.Name, &post.Type, &post.Description, &post.URL,
+		&links, &attachment, &timestamp, &ingestedAt, &tags)
+	if err != nil {
+		return processor.ProcessedMessage{}, err
+	}
+
+	if err := json.Unmarshal([]byte(links), &post.Links); err != nil {
+		return processor.ProcessedMessage{}, fmt.Errorf("invalid links of message %d: %w", post.MessageID, err)
+	}
+	if err := json.Unmarshal([]byte(tags), &post.Tags); err != nil {
+		return processor.ProcessedMessage{}, fmt.Errorf("invalid tags of message %d: %w", post.MessageID, err)
+	}
+	if attachment.Valid {
+		post.Attachment = &processor.Attachment{}
+		if err := json.Unmarshal([]byte(attachment.String), post.Attachment); err != nil {
+			return processor.ProcessedMessage{}, fmt.Errorf("invalid attachment of message %d: %w", post.MessageID, err)
+		}
+	}
+	post.Timestamp = time.UnixMilli(timestamp).UTC()
+	post.IngestedAt = time.UnixMilli(ingestedAt).UTC()
+
+	return post, nil
+}
+
+// matchExpression turns a search query into an FTS5 expression requiring
+// every word of the query, or one of its variants, as a prefix of a word of
+// the name or of the folded name, see translit.Variants. Words are quoted, so
+// FTS5 operators in the query are matched literally.
+func matchExpression(query string) string {
+	var groups []string
+	for _, variants := range translit.Query(query) {
+		if len(sqlstore.Words(variants[0])) == 0 {
+			// Separators between words are ignored
+			continue
+		}
+
+		var alternatives []string
+		for _, variant := range variants {
+			terms := sqlstore.Words(variant)
+			if len(terms) == 0 {
+				continue
+			}
+			for i, term := range terms {
+				terms[i] = `"` + term + `"*`
+			}
+			alternatives = append(alternatives, "("+strings.Join(terms, " ")+")")
+		}
+		groups = append(groups, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	if len(groups) == 0 {
+		// Matches nothing, like a query consisting only of separators
+		return `""`
+	}
+
+	return strings.Join(groups, " AND ")
+}
+
+// nullString returns b as a string, or nil for SQL NULL if b is empty.
+func nullString(b []byte) any {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
+
+// startSpan starts a client span for a query.
+func startSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", "sqlite"),
+		attribute.String("db.operation.name", operation),
+	))
+}
@@ -0,0 +1,101 @@
+// Package sqlstore provides the helpers shared by the SQL implementations of
+// storage.Store, which differ in their drivers and dialects but build and
+// run their queries the same way.
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage"
+)
+
+// Rows is a result set being read, as returned by the drivers of the stores.
+type Rows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+	Close()
+}
+
+// QueryFunc runs a query on the database of a store.
+type QueryFunc func(ctx context.Context, query string, args ...any) (Rows, error)
+
+// QueryStrings runs a query returning a single text column.
+// The result is never nil, so it is encoded as an empty JSON array.
+func QueryStrings(ctx context.Context, query QueryFunc, sql string, args ...any) ([]string, error) {
+	rows, err := query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+// QueryCounts runs a query returning the values of a facet and their counts.
+// The result is never nil, so it is encoded as an empty JSON array.
+func QueryCounts(ctx context.Context, query QueryFunc, sql string, args ...any) ([]storage.FacetCount, error) {
+	rows, err := query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []storage.FacetCount{}
+	for rows.Next() {
+		var count storage.FacetCount
+		if err := rows.Scan(&count.Value, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+// WhereClause returns a WHERE clause requiring all conditions, or "" if
+// there are none.
+func WhereClause(conditions ...string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conditions, " AND ")
+}
+
+// Words splits text into its runs of letters and digits.
+func Words(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// IgnoreNotFound returns nil for storage.ErrNotFound and
+// deadletter.ErrNotFound, so that looking up a missing post or dead-letter
+// entry is not traced as a failure
+func IgnoreNotFound(err error) error {
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, deadletter.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// LogQuery records the duration of a query at debug level, tagged with the
+// correlation ID of the request that issued it
+func LogQuery(ctx context.Context, query string, start time.Time) {
+	slog.DebugContext(ctx, "Query finished", "query", query, "duration_ms", time.Since(start).Milliseconds())
+}
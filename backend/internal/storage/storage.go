@@ -0,0 +1,70 @@
+// Package storage defines the repository of processed posts that the API
+// server and the persistence stage of the pipeline depend on, so that the
+// backing database can be replaced, e.g. by an in-memory store in tests.
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+)
+
+// ErrNotFound is returned when a requested post does not exist.
+var ErrNotFound = errors.New("post not found")
+
+// PostsResponse represents the response structure for post queries
+type PostsResponse struct {
+	Posts      []processor.ProcessedMessage
+	TotalCount int64
+	Facets     *Facets // Counts of the values of all matching posts, nil unless requested
+}
+
+// Facets count the posts matching a query by type, tag and language, so
+// that filters can show how many posts each value would leave.
+// Values are ordered from the most to the least frequent, then ascending.
+type Facets struct {
+	Types     []FacetCount `json:"type"`     // Posts of each type
+	Tags      []FacetCount `json:"tags"`     // Posts with each tag, without the "#" prefix
+	Languages []FacetCount `json:"language"` // Posts in each language, see GetLanguages
+}
+
+// FacetCount is the number of matching posts with a value of a facet.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// Store is implemented by repositories of processed posts.
+// Posts are identified by their Telegram chat and message IDs.
+type Store interface {
+	// SaveMessage inserts a post, or replaces the stored fields of a post
+	// saved before while keeping its ingestion time.
+	SaveMessage(ctx context.Context, message processor.ProcessedMessage) error
+	// GetPostsWithFilters retrieves one page of the posts matching all
+	// non-empty filters, newest first, together with the number of matches.
+	// query searches post names case-insensitively; how its words are
+	// matched depends on the store, which may also rank matches by
+	// relevance instead of date. Stores also match transliterated and
+	// wrong-layout spellings of query words against folded names, see
+	// package translit. tag matches a tag exactly, language matches the
+	// last tag exactly (see GetLanguages) and library and postType match
+	// exactly. Returned tags have no "#" prefix.
+	GetPostsWithFilters(ctx context.Context, query, tag, postType, language, library string, page, limit int) (PostsResponse, error)
+	// GetPostsWithFacets is like GetPostsWithFilters, but also counts the
+	// types, tags and languages of all matching posts in Facets.
+	GetPostsWithFacets(ctx context.Context, query, tag, postType, language, library string, page, limit int) (PostsResponse, error)
+	// GetPost retrieves a single post, or returns ErrNotFound.
+	GetPost(ctx context.Context, chatID int64, messageID int) (processor.ProcessedMessage, error)
+	// GetTags retrieves all unique tags in ascending order, without the
+	// "#" prefix, limited to the posts of one library unless library is empty.
+	GetTags(ctx context.Context, library string) ([]string, error)
+	// GetLanguages retrieves the unique language codes, which are the last
+	// tags of posts consisting of two lowercase letters, in ascending order,
+	// limited to the posts of one library unless library is empty.
+	GetLanguages(ctx context.Context, library string) ([]string, error)
+	// GetLibraries retrieves the identifiers of all libraries that have posts, in ascending order.
+	GetLibraries(ctx context.Context) ([]string, error)
+	// Ping verifies that the store is reachable.
+	Ping(ctx context.Context) error
+}
@@ -0,0 +1,298 @@
+// Package storagetest checks that implementations of storage.Store follow
+// the filter, ordering, pagination and upsert semantics of the interface,
+// so that every storage backend can be tested the same way. How search
+// queries match is store-dependent and is tested by each store.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage"
+)
+
+// ChatID is the Telegram chat of the posts saved by Fill.
+const ChatID = 100
+
+// Base is the Telegram timestamp of the oldest post saved by Fill.
+var Base = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Posts are saved by Fill, from the oldest to the newest.
+var Posts = []processor.ProcessedMessage{
+	{MessageID: 1, Library: "books", Name: "Learning Go", Type: "book", Tags: []string{"#golang", "en"}, Description: "A gentle introduction"},
+	{MessageID: 2, Library: "books", Name: "Программирование на C++", Type: "book", Tags: []string{"cpp", "ru"}},
+	{MessageID: 3, Library: "courses", Name: "Go concurrency patterns", Type: "course", Tags: []string{"go", "en"}, Description: "Channels and select"},
+	{MessageID: 4, Library: "courses", Name: "Привет, мир", Type: "course", Tags: []string{"intro", "ru"}},
+	{MessageID: 5, Library: "books", Name: "Rust in action", Type: "book", Tags: []string{"rust", "den"}},
+}
+
+// Fill saves Posts to store, posted an hour apart.
+func Fill(t *testing.T, store storage.Store) {
+	t.Helper()
+	for i, post := range Posts {
+		post.ChatID = ChatID
+		post.Timestamp = Base.Add(time.Duration(i) * time.Hour)
+		if err := store.SaveMessage(context.Background(), post); err != nil {
+			t.Fatalf("SaveMessage(%d): %v", post.MessageID, err)
+		}
+	}
+}
+
+// IDs returns the message IDs of posts in order.
+func IDs(posts []processor.ProcessedMessage) []int {
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.MessageID
+	}
+	return ids
+}
+
+// Run tests the store returned by newStore, which must be empty.
+func Run(t *testing.T, newStore func(t *testing.T) storage.Store) {
+	filled := func(t *testing.T) storage.Store {
+		store := newStore(t)
+		Fill(t, store)
+		return store
+	}
+
+	t.Run("Filters", func(t *testing.T) { testFilters(t, filled(t)) })
+	t.Run("Pagination", func(t *testing.T) { testPagination(t, filled(t)) })
+	t.Run("Ties", func(t *testing.T) { testTies(t, newStore(t)) })
+	t.Run("TagPrefix", func(t *testing.T) { testTagPrefix(t, filled(t)) })
+	t.Run("Facets", func(t *testing.T) { testFacets(t, filled(t)) })
+	t.Run("Upsert", func(t *testing.T) { testUpsert(t, filled(t)) })
+	t.Run("GetPost", func(t *testing.T) { testGetPost(t, filled(t)) })
+	t.Run("Values", func(t *testing.T) { testValues(t, filled(t)) })
+}
+
+func testFilters(t *testing.T, store storage.Store) {
+	tests := []struct {
+		name                                    string
+		query, tag, postType, language, library string
+		want                                    []int
+	}{
+		{name: "no filters", want: []int{5, 4, 3, 2, 1}},
+		{name: "library", library: "books", want: []int{5, 2, 1}},
+		{name: "type", postType: "course", want: []int{4, 3}},
+		{name: "tag", tag: "go", want: []int{3}},
+		{name: "tag with prefix", tag: "#golang", want: []int{1}},
+		{name: "language matches last tag exactly", language: "en", want: []int{3, 1}},
+		{name: "language is not a suffix", language: "n", want: nil},
+		{name: "language is not a pattern", language: "..", want: nil},
+		{name: "combined filters", library: "books", language: "ru", want: []int{2}},
+		{name: "word of name", query: "learning", want: []int{1}},
+		{name: "transliterated", query: "privet", want: []int{4}},
+		{name: "wrong layout", query: "ghbdtn", want: []int{4}},
+		{name: "query and filters", query: "privet", library: "books", want: nil},
+		{name: "unbalanced parenthesis", query: "(", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := store.GetPostsWithFilters(context.Background(), tt.query, tt.tag, tt.postType, tt.language, tt.library, 1, 10)
+			if err != nil {
+				t.Fatalf("GetPostsWithFilters: %v", err)
+			}
+			if got := IDs(response.Posts); !slices.Equal(got, tt.want) {
+				t.Errorf("posts = %v, want %v", got, tt.want)
+			}
+			if response.TotalCount != int64(len(tt.want)) {
+				t.Errorf("TotalCount = %d, want %d", response.TotalCount, len(tt.want))
+			}
+		})
+	}
+}
+
+func testPagination(t *testing.T, store storage.Store) {
+	tests := []struct {
+		page, limit int
+		want        []int
+	}{
+		{page: 1, limit: 2, want: []int{5, 4}},
+		{page: 2, limit: 2, want: []int{3, 2}},
+		{page: 3, limit: 2, want: []int{1}},
+		{page: 4, limit: 2, want: nil},
+		{page: 2, limit: 0, want: []int{5, 4, 3, 2, 1}},
+	}
+
+	for _, tt := range tests {
+		response, err := store.GetPostsWithFilters(context.Background(), "", "", "", "", "", tt.page, tt.limit)
+		if err != nil {
+			t.Fatalf("GetPostsWithFilters(page %d, limit %d): %v", tt.page, tt.limit, err)
+		}
+		if got := IDs(response.Posts); !slices.Equal(got, tt.want) {
+			t.Errorf("page %d, limit %d: posts = %v, want %v", tt.page, tt.limit, got, tt.want)
+		}
+		if response.TotalCount != int64(len(Posts)) {
+			t.Errorf("page %d, limit %d: TotalCount = %d, want %d", tt.page, tt.limit, response.TotalCount, len(Posts))
+		}
+	}
+}
+
+// testTies checks that posts with the same timestamp are ordered from the
+// last to the first saved.
+func testTies(t *testing.T, store storage.Store) {
+	for id := 1; id <= 3; id++ {
+		post := processor.ProcessedMessage{ChatID: ChatID, MessageID: id, Name: "Post", Type: "book", Timestamp: Base}
+		if err := store.SaveMessage(context.Background(), post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	response, err := store.GetPostsWithFilters(context.Background(), "", "", "", "", "", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := IDs(response.Posts), []int{3, 2, 1}; !slices.Equal(got, want) {
+		t.Errorf("posts = %v, want %v", got, want)
+	}
+}
+
+func testTagPrefix(t *testing.T, store storage.Store) {
+	response, err := store.GetPostsWithFilters(context.Background(), "", "", "", "", "", 5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Posts) != 1 {
+		t.Fatalf("posts = %v, want post 1", IDs(response.Posts))
+	}
+	if got, want := response.Posts[0].Tags, []string{"golang", "en"}; !slices.Equal(got, want) {
+		t.Errorf("Tags = %v, want %v", got, want)
+	}
+}
+
+func testFacets(t *testing.T, store storage.Store) {
+	response, err := store.GetPostsWithFacets(context.Background(), "", "", "", "", "books", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := IDs(response.Posts), []int{5}; !slices.Equal(got, want) {
+		t.Errorf("posts = %v, want %v", got, want)
+	}
+	if response.TotalCount != 3 {
+		t.Errorf("TotalCount = %d, want 3", response.TotalCount)
+	}
+
+	want := storage.Facets{
+		Types: []storage.FacetCount{{Value: "book", Count: 3}},
+		Tags: []storage.FacetCount{
+			{Value: "cpp", Count: 1}, {Value: "den", Count: 1}, {Value: "en", Count: 1},
+			{Value: "golang", Count: 1}, {Value: "ru", Count: 1}, {Value: "rust", Count: 1},
+		},
+		Languages: []storage.FacetCount{{Value: "en", Count: 1}, {Value: "ru", Count: 1}},
+	}
+	got := response.Facets
+	if got == nil {
+		t.Fatal("Facets = nil")
+	}
+	if !slices.Equal(got.Types, want.Types) || !slices.Equal(got.Tags, want.Tags) || !slices.Equal(got.Languages, want.Languages) {
+		t.Errorf("Facets = %+v, want %+v", *got, want)
+	}
+
+	// Facets are not counted unless requested
+	response, err = store.GetPostsWithFilters(context.Background(), "", "", "", "", "books", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Facets != nil {
+		t.Errorf("Facets = %+v without facets requested", *response.Facets)
+	}
+}
+
+func testUpsert(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+
+	before, err := store.GetPost(ctx, ChatID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated := Posts[0]
+	updated.ChatID = ChatID
+	updated.Name = "Learning Go, second edition"
+	updated.Tags = []string{"go", "en"}
+	updated.Timestamp = Base
+	if err := store.SaveMessage(ctx, updated); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := store.GetPost(ctx, ChatID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Name != updated.Name || !slices.Equal(after.Tags, updated.Tags) {
+		t.Errorf("post = %q %v, want %q %v", after.Name, after.Tags, updated.Name, updated.Tags)
+	}
+	if !after.IngestedAt.Equal(before.IngestedAt) {
+		t.Errorf("IngestedAt = %v, want the original %v", after.IngestedAt, before.IngestedAt)
+	}
+
+	response, err := store.GetPostsWithFilters(ctx, "edition", "", "", "", "", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := IDs(response.Posts), []int{1}; !slices.Equal(got, want) {
+		t.Errorf("search for the new name: posts = %v, want %v", got, want)
+	}
+	response, err = store.GetPostsWithFilters(ctx, "", "go", "", "", "", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := IDs(response.Posts), []int{3, 1}; !slices.Equal(got, want) {
+		t.Errorf("filter on the new tags: posts = %v, want %v", got, want)
+	}
+	response, err = store.GetPostsWithFilters(ctx, "", "", "", "", "", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.TotalCount != int64(len(Posts)) {
+		t.Errorf("TotalCount = %d after upsert, want %d", response.TotalCount, len(Posts))
+	}
+}
+
+func testGetPost(t *testing.T, store storage.Store) {
+	post, err := store.GetPost(context.Background(), ChatID, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Posts[2]
+	if post.Name != want.Name || post.Library != want.Library || post.Description != want.Description ||
+		!post.Timestamp.Equal(Base.Add(2*time.Hour)) || post.IngestedAt.IsZero() {
+		t.Errorf("GetPost = %+v, want %+v", post, want)
+	}
+
+	if _, err := store.GetPost(context.Background(), ChatID, 42); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetPost of a missing post: error = %v, want %v", err, storage.ErrNotFound)
+	}
+}
+
+func testValues(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		get  func() ([]string, error)
+		want []string
+	}{
+		{"tags", func() ([]string, error) { return store.GetTags(ctx, "") }, []string{"cpp", "den", "en", "go", "golang", "intro", "ru", "rust"}},
+		{"tags of library", func() ([]string, error) { return store.GetTags(ctx, "courses") }, []string{"en", "go", "intro", "ru"}},
+		{"tags of unknown library", func() ([]string, error) { return store.GetTags(ctx, "films") }, []string{}},
+		{"languages", func() ([]string, error) { return store.GetLanguages(ctx, "") }, []string{"en", "ru"}},
+		{"languages of library", func() ([]string, error) { return store.GetLanguages(ctx, "courses") }, []string{"en", "ru"}},
+		{"libraries", func() ([]string, error) { return store.GetLibraries(ctx) }, []string{"books", "courses"}},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.get()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Package supervisor runs the long-lived loops of the ingestion pipeline,
+// recovering from panics and restarting failed loops with exponential backoff,
+// and keeps track of each component's health for monitoring.
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+)
+
+// State describes what a supervised component is currently doing.
+type State string
+
+// Component states.
+const (
+	StateStarting   State = "starting"   // The component was added but has not started yet
+	StateRunning    State = "running"    // The component is working
+	StateRestarting State = "restarting" // The component failed and is waiting to be restarted
+	StateFailed     State = "failed"     // The component failed too often and was given up on
+	StateStopped    State = "stopped"    // The component finished after being stopped
+)
+
+// Restart policy. These are variables so that tests can shorten the delays.
+var (
+	initialBackoff = time.Second     // Delay before the first restart
+	maxBackoff     = time.Minute     // Upper bound of the doubling restart delay
+	maxRestarts    = 20              // Consecutive failures after which a component is given up on
+	stableAfter    = 5 * time.Minute // Run time after which earlier failures are forgiven
+)
+
+// Status is a snapshot of a component's health.
+type Status struct {
+	Name          string     `json:"name"`                      // Name of the component
+	State         State      `json:"state"`                     // Current state
+	Restarts      int        `json:"restarts"`                  // Number of restarts since the service started
+	LastError     string     `json:"last_error,omitempty"`      // Error of the latest failure
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`   // Time of the latest failure
+	LastMessageAt *time.Time `json:"last_message_at,omitempty"` // Time the component last handled a message
+}
+
+// Healthy reports whether the component is running or has stopped normally.
+// A component that has not started yet is not healthy.
+func (s Status) Healthy() bool {
+	return s.State == StateRunning || s.State == StateStopped
+}
+
+// Supervisor keeps track of the components of the service.
+type Supervisor struct {
+	mu         sync.Mutex
+	components []*Component // Components in the order they were added
+}
+
+// New creates a Supervisor without components.
+func New() *Supervisor {
+	return &Supervisor{}
+}
+
+// Add registers a component under the given name. The component is starting
+// until it is run with Run or marked as running with Started.
+func (s *Supervisor) Add(name string) *Component {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := &Component{status: Status{Name: name, State: StateStarting}}
+	s.components = append(s.components, c)
+	return c
+}
+
+// Status returns the status of every component, in the order they were added.
+func (s *Supervisor) Status() []Status {
+	s.mu.Lock()
+	components := slices.Clone(s.components)
+	s.mu.Unlock()
+
+	statuses := make([]Status, 0, len(components))
+	for _, c := range components {
+		statuses = append(statuses, c.Status())
+	}
+	return statuses
+}
+
+// Healthy reports whether all components are healthy.
+func (s *Supervisor) Healthy() bool {
+	for _, status := range s.Status() {
+		if !status.Healthy() {
+			return false
+		}
+	}
+	return true
+}
+
+// Component is a supervised part of the service, such as a pipeline stage.
+type Component struct {
+	mu     sync.Mutex
+	status Status // Current health of the component
+}
+
+// Run calls fn until it returns nil, which means the component finished
+// normally. If fn returns an error or panics, the failure is recorded and fn
+// is called again after an exponentially growing delay. Once fn has failed
+// maxRestarts times in a row without running stably in between, the
+// component is marked as failed and Run returns the last error.
+// Run also returns, with ctx.Err(), if ctx is done while waiting to restart.
+// It blocks, so callers usually run it in a separate goroutine.
+func (c *Component) Run(ctx context.Context, fn func() error) error {
+	backoff := initialBackoff
+	failures := 0
+
+	for {
+		c.setState(StateRunning)
+		started := time.Now()
+
+		err := call(fn)
+		if err == nil {
+			c.setState(StateStopped)
+			return nil
+		}
+
+		if time.Since(started) >= stableAfter {
+			backoff, failures = initialBackoff, 0
+		}
+		failures++
+
+		name := c.Status().Name
+		if failures >= maxRestarts {
+			c.fail(StateFailed, err)
+			slog.Error("Component failed too many times in a row, giving up", "component", name, "failures", failures, "error", err)
+			return err
+		}
+
+		c.fail(StateRestarting, err)
+		slog.Warn("Component failed, restarting", "component", name, "backoff", backoff.String(), "error", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			c.setState(StateStopped)
+			return ctx.Err()
+		}
+
+		c.mu.Lock()
+		c.status.Restarts++
+		c.mu.Unlock()
+
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// Started marks a component that is not run by Run, such as one handling
+// webhook requests, as running.
+func (c *Component) Started() {
+	c.setState(StateRunning)
+}
+
+// Beat records that the component has just handled a message.
+func (c *Component) Beat() {
+	now := time.Now().UTC()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.LastMessageAt = &now
+}
+
+// Status returns a snapshot of the component's health.
+func (c *Component) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// setState changes the component's state.
+func (c *Component) setState(state State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.State = state
+}
+
+// fail changes the component's state and records the failure.
+func (c *Component) fail(state State, err error) {
+	now := time.Now().UTC()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.State = state
+	c.status.LastError = err.Error()
+	c.status.LastErrorAt = &now
+}
+
+// call runs fn, converting a panic into an error. The stack trace of the
+// panic is logged.
+func call(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Recovered panic", "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return fn()
+}
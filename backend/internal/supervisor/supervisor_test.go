@@ -0,0 +1,168 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func init() {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// shortenBackoff makes restarts immediate for the duration of the test.
+func shortenBackoff(t *testing.T) {
+	t.Helper()
+	initial, limit := initialBackoff, maxBackoff
+	initialBackoff, maxBackoff = time.Millisecond, time.Millisecond
+	t.Cleanup(func() { initialBackoff, maxBackoff = initial, limit })
+}
+
+func TestAddIsStarting(t *testing.T) {
+	s := New()
+	c := s.Add("writer")
+
+	if got := c.Status(); got.Name != "writer" || got.State != StateStarting {
+		t.Errorf("Status = %+v, want writer starting", got)
+	}
+	if s.Healthy() {
+		t.Error("Healthy with a component that has not started, want false")
+	}
+
+	c.Started()
+	if got := c.Status().State; got != StateRunning {
+		t.Errorf("State after Started = %q, want %q", got, StateRunning)
+	}
+	if !s.Healthy() {
+		t.Error("Healthy with a running component = false, want true")
+	}
+}
+
+func TestRunRestartsAfterFailure(t *testing.T) {
+	shortenBackoff(t)
+	c := New().Add("processor")
+
+	calls := 0
+	err := c.Run(context.Background(), func() error {
+		calls++
+		switch calls {
+		case 1:
+			return errors.New("connection lost")
+		case 2:
+			panic("nil map")
+		}
+		if got := c.Status(); got.State != StateRunning || got.Restarts != 2 {
+			t.Errorf("Status after restarts = %+v, want running after 2 restarts", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("fn was called %d times, want 3", calls)
+	}
+
+	got := c.Status()
+	if got.State != StateStopped || got.Restarts != 2 {
+		t.Errorf("Status = %+v, want stopped after 2 restarts", got)
+	}
+	if got.LastError != "panic: nil map" || got.LastErrorAt == nil {
+		t.Errorf("last error = %q at %v, want the recovered panic", got.LastError, got.LastErrorAt)
+	}
+}
+
+func TestRunGivesUp(t *testing.T) {
+	shortenBackoff(t)
+	s := New()
+	c := s.Add("writer")
+
+	failure := errors.New("database unavailable")
+	calls := 0
+	err := c.Run(context.Background(), func() error {
+		calls++
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Run = %v, want the last error", err)
+	}
+	if calls != maxRestarts {
+		t.Errorf("fn was called %d times, want %d", calls, maxRestarts)
+	}
+
+	got := c.Status()
+	if got.State != StateFailed || got.Restarts != maxRestarts-1 || got.LastError != failure.Error() {
+		t.Errorf("Status = %+v, want failed after %d restarts", got, maxRestarts-1)
+	}
+	if s.Healthy() {
+		t.Error("Healthy with a failed component, want false")
+	}
+}
+
+func TestRunStopsWhileRestarting(t *testing.T) {
+	c := New().Add("bot")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- c.Run(ctx, func() error { return errors.New("polling failed") })
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for c.Status().State != StateRestarting {
+		if time.Now().After(deadline) {
+			t.Fatalf("State = %q, want %q", c.Status().State, StateRestarting)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Run = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+	if got := c.Status(); got.State != StateStopped || got.Restarts != 0 {
+		t.Errorf("Status = %+v, want stopped without restarts", got)
+	}
+}
+
+func TestBeat(t *testing.T) {
+	c := New().Add("processor")
+	if got := c.Status().LastMessageAt; got != nil {
+		t.Errorf("LastMessageAt = %v before any message, want nil", got)
+	}
+
+	before := time.Now()
+	c.Beat()
+	got := c.Status().LastMessageAt
+	if got == nil || got.Before(before.Add(-time.Second)) || got.After(time.Now().Add(time.Second)) {
+		t.Errorf("LastMessageAt = %v, want about %v", got, before)
+	}
+	if got.Location() != time.UTC {
+		t.Errorf("LastMessageAt is in %v, want UTC", got.Location())
+	}
+}
+
+func TestStatusOrder(t *testing.T) {
+	s := New()
+	for _, name := range []string{"bot", "processor", "writer"} {
+		s.Add(name)
+	}
+
+	statuses := s.Status()
+	if len(statuses) != 3 {
+		t.Fatalf("Status has %d components, want 3", len(statuses))
+	}
+	for i, name := range []string{"bot", "processor", "writer"} {
+		if statuses[i].Name != name {
+			t.Errorf("component %d = %q, want %q", i, statuses[i].Name, name)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Package tgexport provides functionality for reading channel history exported
+// by Telegram Desktop ("Export chat history" in JSON format). It converts the
+// exported messages into Telegram Bot API messages so they can be handled by
+// the same code paths as posts received by the bot.
+package tgexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// channelIDOffset is subtracted from an exported channel ID to obtain the
+// identifier used by the Bot API (-100 followed by the channel ID).
+const channelIDOffset = 1000000000000
+
+// Export represents the contents of a Telegram Desktop "result.json" file.
+type Export struct {
+	Name     string    `json:"name"`     // Title of the exported chat
+	Type     string    `json:"type"`     // Kind of chat, e.g. "public_channel"
+	ID       int64     `json:"id"`       // Chat identifier without the Bot API prefix
+	Messages []Message `json:"messages"` // Exported messages in chronological order
+}
+
+// Message represents a single exported message. Only the fields needed to
+// rebuild the message text, its entities and attached files are decoded.
+type Message struct {
+	ID            int      `json:"id"`              // Identifier of the message inside the chat
+	Type          string   `json:"type"`            // "message" for posts, "service" for service events
+	Date          string   `json:"date"`            // Local time the message was sent
+	DateUnixtime  string   `json:"date_unixtime"`   // Unix time the message was sent
+	TextEntities  []Entity `json:"text_entities"`   // Message text split into formatted fragments
+	File          string   `json:"file"`            // Relative path of an attached file
+	FileName      string   `json:"file_name"`       // Original name of the attached file
+	FileSize      int      `json:"file_size"`       // Size of the attached file in bytes
+	MimeType      string   `json:"mime_type"`       // MIME type of the attached file
+	MediaType     string   `json:"media_type"`      // Kind of media file, e.g. "video_file"; empty for documents
+	Photo         string   `json:"photo"`           // Relative path of an attached photo
+	PhotoFileSize int      `json:"photo_file_size"` // Size of the attached photo in bytes
+}
+
+// Entity is a fragment of exported message text with its formatting type.
+type Entity struct {
+	Type string `json:"type"`           // Formatting type, e.g. "plain", "link" or "text_link"
+	Text string `json:"text"`           // Visible text of the fragment
+	Href string `json:"href,omitempty"` // Target of a "text_link" fragment
+}
+
+// entityTypes maps export fragment types to Bot API entity types where they differ.
+var entityTypes = map[string]string{
+	"link": "url",
+}
+
+// Load reads and decodes a Telegram Desktop JSON export from the given path.
+// Returns an error if the file cannot be read or is not a valid export.
+func Load(path string) (*Export, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export: %w", err)
+	}
+
+	var export Export
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("failed to decode export: %w", err)
+	}
+
+	return &export, nil
+}
+
+// ChatID returns the Bot API identifier of the exported chat.
+// Channel IDs in exports lack the "-100" prefix used by the Bot API.
+func (e *Export) ChatID() int64 {
+	if e.ID <= 0 {
+		return e.ID
+	}
+	return -channelIDOffset - e.ID
+}
+
+// Posts converts all regular messages of the export into Bot API messages
+// posted in the given chat. Service messages (channel creation, pinned
+// messages, etc.) are skipped. Exports do not contain Bot API file IDs, so
+// attachments only carry the file metadata.
+func (e *Export) Posts(chatID int64) []*tgbotapi.Message {
+	chat := &tgbotapi.Chat{ID: chatID, Title: e.Name}
+
+	posts := make([]*tgbotapi.Message, 0, len(e.Messages))
+	for _, message := range e.Messages {
+		if message.Type != "message" {
+			continue
+		}
+
+		text, entities := buildText(message.TextEntities)
+
+		post := &tgbotapi.Message{
+			MessageID: message.ID,
+			Date:      int(message.unixTime()),
+			Chat:      chat,
+		}
+
+		// Text of media messages is their caption
+		if message.attachMedia(post) {
+			post.Caption, post.CaptionEntities = text, entities
+		} else {
+			post.Text, post.Entities = text, entities
+		}
+
+		posts = append(posts, post)
+	}
+
+	return posts
+}
+
+// attachMedia sets the photo, document, video or audio of the post from the
+// exported file metadata. Returns false if the message has no attached file.
+func (m Message) attachMedia(post *tgbotapi.Message) bool {
+	switch {
+	case m.Photo != "":
+		post.Photo = []tgbotapi.PhotoSize{{FileSize: m.PhotoFileSize}}
+
+	case m.File != "" && m.MediaType == "video_file":
+		post.Video = &tgbotapi.Video{FileName: m.FileName, MimeType: m.MimeType, FileSize: m.FileSize}
+
+	case m.File != "" && m.MediaType == "audio_file":
+		post.Audio = &tgbotapi.Audio{FileName: m.FileName, MimeType: m.MimeType, FileSize: m.FileSize}
+
+	case m.File != "":
+		post.Document = &tgbotapi.Document{FileName: m.FileName, MimeType: m.MimeType, FileSize: m.FileSize}
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+// unixTime returns the time the message was sent in Unix seconds.
+// It prefers the exact "date_unixtime" field and falls back to parsing
+// "date", which older exports write in local time without a zone.
+func (m Message) unixTime() int64 {
+	if seconds, err := strconv.ParseInt(m.DateUnixtime, 10, 64); err == nil {
+		return seconds
+	}
+
+	if date, err := time.ParseInLocation("2006-01-02T15:04:05", m.Date, time.Local); err == nil {
+		return date.Unix()
+	}
+
+	return 0
+}
+
+// buildText concatenates exported text fragments back into the message text
+// and recreates the matching Bot API entities. Entity offsets and lengths are
+// measured in UTF-16 code units, as they are in updates sent by Telegram.
+func buildText(fragments []Entity) (string, []tgbotapi.MessageEntity) {
+	var text []byte
+	var entities []tgbotapi.MessageEntity
+	offset := 0
+
+	for _, fragment := range fragments {
+		length := len(utf16.Encode([]rune(fragment.Text)))
+
+		if fragment.Type != "plain" && length > 0 {
+			entityType := fragment.Type
+			if mapped, ok := entityTypes[entityType]; ok {
+				entityType = mapped
+			}
+
+			entities = append(entities, tgbotapi.MessageEntity{
+				Type:   entityType,
+				Offset: offset,
+				Length: length,
+				URL:    fragment.Href,
+			})
+		}
+
+		text = append(text, fragment.Text...)
+		offset += length
+	}
+
+	return string(text), entities
+}
@@ -0,0 +1,109 @@
+package tgexport
+
+import (
+	"reflect"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+)
+
+func TestBuildText(t *testing.T) {
+	tests := []struct {
+		name         string
+		fragments    []Entity
+		wantText     string
+		wantEntities []tgbotapi.MessageEntity
+	}{
+		{
+			name: "plain text only",
+			fragments: []Entity{
+				{Type: "plain", Text: "Name: Go"},
+			},
+			wantText: "Name: Go",
+		},
+		{
+			name: "link after emoji",
+			fragments: []Entity{
+				{Type: "plain", Text: "🚀 Docs: "},
+				{Type: "link", Text: "go.dev"},
+			},
+			wantText:     "🚀 Docs: go.dev",
+			wantEntities: []tgbotapi.MessageEntity{{Type: "url", Offset: 9, Length: 6}},
+		},
+		{
+			name: "text link after flag and Cyrillic",
+			fragments: []Entity{
+				{Type: "plain", Text: "🇺🇦 Книга: "},
+				{Type: "text_link", Text: "читать", Href: "https://example.com/book"},
+			},
+			wantText:     "🇺🇦 Книга: читать",
+			wantEntities: []tgbotapi.MessageEntity{{Type: "text_link", Offset: 12, Length: 6, URL: "https://example.com/book"}},
+		},
+		{
+			name: "non-BMP fragments",
+			fragments: []Entity{
+				{Type: "bold", Text: "𝔾𝕠"},
+				{Type: "plain", Text: " 👨‍👩‍👧 "},
+				{Type: "link", Text: "https://a.dev"},
+			},
+			wantText: "𝔾𝕠 👨‍👩‍👧 https://a.dev",
+			wantEntities: []tgbotapi.MessageEntity{
+				{Type: "bold", Offset: 0, Length: 4},
+				{Type: "url", Offset: 14, Length: 13},
+			},
+		},
+		{
+			name: "empty fragment",
+			fragments: []Entity{
+				{Type: "bold", Text: ""},
+				{Type: "plain", Text: "Go"},
+			},
+			wantText: "Go",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := buildText(tt.fragments)
+			if text != tt.wantText {
+				t.Errorf("text = %q, want %q", text, tt.wantText)
+			}
+			if !reflect.DeepEqual(entities, tt.wantEntities) {
+				t.Errorf("entities = %+v, want %+v", entities, tt.wantEntities)
+			}
+		})
+	}
+}
+
+// TestPostsLinks checks that the entities of imported posts point at the
+// same text as the bot reads from them.
+func TestPostsLinks(t *testing.T) {
+	export := &Export{Messages: []Message{{
+		ID:   1,
+		Type: "message",
+		TextEntities: []Entity{
+			{Type: "plain", Text: "Name: 𝔾𝕠 🚀\nType: book\nTags: #go\n"},
+			{Type: "text_link", Text: "Читать 📘", Href: "https://example.com/book"},
+			{Type: "plain", Text: " 🇺🇦 "},
+			{Type: "link", Text: "go.dev"},
+		},
+	}}}
+
+	posts := export.Posts(-100)
+	if len(posts) != 1 {
+		t.Fatalf("Posts returned %d posts, want 1", len(posts))
+	}
+
+	msg := bot.NewMessage(posts[0], "books", false)
+	want := []bot.Link{
+		{URL: "https://example.com/book", Text: "Читать 📘"},
+		{URL: "https://go.dev", Text: "go.dev"},
+	}
+	if !reflect.DeepEqual(msg.Links, want) {
+		t.Errorf("Links = %+v, want %+v", msg.Links, want)
+	}
+	if msg.URL != "https://example.com/book" {
+		t.Errorf("URL = %q, want the text link", msg.URL)
+	}
+}
@@ -0,0 +1,188 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/queue"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage/memory"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/supervisor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/tracing"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/writer"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// exporter records the spans of all tests in memory.
+var exporter = tracetest.NewInMemoryExporter()
+
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	tracing.Install(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	os.Exit(m.Run())
+}
+
+// tracer creates the spans started by tests.
+var tracer = otel.Tracer("github.com/kirinyoku/kirinyoku-space-web/backend/internal/tracing_test")
+
+// findSpan returns the recorded span with the given name, failing the test
+// if there is none.
+func findSpan(t *testing.T, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range exporter.GetSpans() {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no %q span was recorded", name)
+	return tracetest.SpanStub{}
+}
+
+// expectChild fails the test unless child continues the trace of parent
+// as its child.
+func expectChild(t *testing.T, child, parent tracetest.SpanStub) {
+	t.Helper()
+	if child.SpanContext.TraceID() != parent.SpanContext.TraceID() {
+		t.Errorf("%s span is in trace %s, want %s", child.Name, child.SpanContext.TraceID(), parent.SpanContext.TraceID())
+	}
+	if child.Parent.SpanID() != parent.SpanContext.SpanID() {
+		t.Errorf("%s span has parent %s, want the %s span %s", child.Name, child.Parent.SpanID(), parent.Name, parent.SpanContext.SpanID())
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	exporter.Reset()
+
+	ctx, span := tracer.Start(context.Background(), "test.inject")
+	carrier := tracing.Inject(ctx)
+	span.End()
+	if carrier["traceparent"] == "" {
+		t.Fatalf("Inject = %v, want a traceparent", carrier)
+	}
+
+	extracted := trace.SpanContextFromContext(tracing.Extract(context.Background(), carrier))
+	if !extracted.IsRemote() || extracted.TraceID() != span.SpanContext().TraceID() || extracted.SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("Extract = %+v, want the remote context of %+v", extracted, span.SpanContext())
+	}
+
+	if carrier := tracing.Inject(context.Background()); carrier != nil {
+		t.Errorf("Inject without a span = %v, want nil", carrier)
+	}
+	type key struct{}
+	ctx = context.WithValue(context.Background(), key{}, "kept")
+	if got := tracing.Extract(ctx, nil); got != ctx {
+		t.Error("Extract without a trace context returned a new context")
+	}
+}
+
+func TestEnd(t *testing.T) {
+	exporter.Reset()
+
+	_, span := tracer.Start(context.Background(), "test.ok")
+	tracing.End(span, nil)
+	_, span = tracer.Start(context.Background(), "test.failed")
+	tracing.End(span, errors.New("boom"))
+
+	if ok := findSpan(t, "test.ok"); ok.Status.Code != codes.Unset || len(ok.Events) != 0 {
+		t.Errorf("span ended without error has status %v and events %v", ok.Status, ok.Events)
+	}
+	failed := findSpan(t, "test.failed")
+	if failed.Status.Code != codes.Error || failed.Status.Description != "boom" {
+		t.Errorf("span ended with an error has status %v, want Error: boom", failed.Status)
+	}
+	if len(failed.Events) != 1 || failed.Events[0].Name != "exception" {
+		t.Errorf("span ended with an error has events %v, want the recorded error", failed.Events)
+	}
+}
+
+// TestPipeline follows a message from the bot through both queues, the
+// processor and the writer, and checks that their spans form one trace.
+func TestPipeline(t *testing.T) {
+	exporter.Reset()
+	dir := t.TempDir()
+
+	// Queue a message like the bot does, then reopen the queue, so that the
+	// trace context has to survive being stored on disk
+	botQueue, err := queue.Open[bot.Message](filepath.Join(dir, "messages.log"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, span := tracer.Start(context.Background(), "bot.handle_update", trace.WithSpanKind(trace.SpanKindConsumer))
+	msg := bot.Message{
+		Library:      "books",
+		Text:         "Name: Learning Go\nType: book\nTags: #go en",
+		URL:          "https://go.dev",
+		ChatID:       -100,
+		MessageID:    1,
+		Date:         time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		TraceContext: tracing.Inject(ctx),
+	}
+	if err := botQueue.Put(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	span.End()
+	botQueue.Close()
+
+	botQueue, err = queue.Open[bot.Message](filepath.Join(dir, "messages.log"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer botQueue.Close()
+	procQueue, err := queue.Open[processor.ProcessedMessage](filepath.Join(dir, "processed.log"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer procQueue.Close()
+
+	proc, err := processor.NewProcessor(botQueue, procQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := memory.New()
+	w, err := writer.New(store, procQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	components := supervisor.New()
+	proc.Start(components.Add("processor"))
+	w.Start(components.Add("writer"))
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := proc.Stop(stopCtx); err != nil {
+		t.Fatalf("processor Stop: %v", err)
+	}
+	if err := w.Stop(stopCtx); err != nil {
+		t.Fatalf("writer Stop: %v", err)
+	}
+
+	if _, err := store.GetPost(context.Background(), -100, 1); err != nil {
+		t.Fatalf("message was not saved: %v", err)
+	}
+
+	received := findSpan(t, "bot.handle_update")
+	processed := findSpan(t, "processor.process")
+	persisted := findSpan(t, "writer.persist")
+	expectChild(t, processed, received)
+	expectChild(t, persisted, processed)
+	if !processed.Parent.IsRemote() || !persisted.Parent.IsRemote() {
+		t.Error("pipeline spans do not continue the trace context stored in the queues")
+	}
+	for _, span := range []tracetest.SpanStub{processed, persisted} {
+		if span.SpanKind != trace.SpanKindConsumer {
+			t.Errorf("%s span has kind %v, want consumer", span.Name, span.SpanKind)
+		}
+	}
+}
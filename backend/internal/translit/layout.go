@@ -0,0 +1,58 @@
+package translit
+
+import "unicode"
+
+// Characters of the keys of the US English, Russian and Ukrainian keyboard
+// layouts, in the same order: the characters at the same position are typed
+// with the same key, without and then with Shift.
+const (
+	englishKeys   = "`qwertyuiop[]asdfghjkl;'zxcvbnm,./" + `~QWERTYUIOP{}ASDFGHJKL:"ZXCVBNM<>?`
+	russianKeys   = "ёйцукенгшщзхъфывапролджэячсмитьбю." + "ЁЙЦУКЕНГШЩЗХЪФЫВАПРОЛДЖЭЯЧСМИТЬБЮ,"
+	ukrainianKeys = "'йцукенгшщзхїфівапролджєячсмитьбю." + "₴ЙЦУКЕНГШЩЗХЇФІВАПРОЛДЖЄЯЧСМИТЬБЮ,"
+)
+
+// Maps from the characters typed with one layout to the characters typed
+// with the same keys with another.
+var (
+	toRussian   = keyMap(russianKeys, englishKeys)
+	toUkrainian = keyMap(ukrainianKeys, englishKeys)
+	toEnglish   = merge(keyMap(englishKeys, russianKeys), keyMap(englishKeys, ukrainianKeys))
+)
+
+// keyMap maps the characters of from to the characters of to at the same position.
+func keyMap(to, from string) map[rune]rune {
+	toRunes, fromRunes := []rune(to), []rune(from)
+	keys := make(map[rune]rune, len(fromRunes))
+	for i, r := range fromRunes {
+		keys[r] = toRunes[i]
+	}
+	return keys
+}
+
+// merge adds the entries of b missing from a to a and returns a.
+func merge(a, b map[rune]rune) map[rune]rune {
+	for r, key := range b {
+		if _, ok := a[r]; !ok {
+			a[r] = key
+		}
+	}
+	return a
+}
+
+// retype returns the text typed with the keys used to type word, after
+// switching to the layout of keys, and whether every character of word was
+// typed with one of the keys or is a digit, which is typed alike with all
+// layouts.
+func retype(word string, keys map[rune]rune) (string, bool) {
+	runes := []rune(word)
+	for i, r := range runes {
+		key, ok := keys[r]
+		switch {
+		case ok:
+			runes[i] = key
+		case !unicode.IsDigit(r):
+			return "", false
+		}
+	}
+	return string(runes), true
+}
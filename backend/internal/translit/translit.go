@@ -0,0 +1,154 @@
+// Package translit folds the Cyrillic and Latin spellings of names together,
+// so that searches typed in transliteration or with the wrong keyboard layout
+// still find posts. Stores index the folded form of every name next to the
+// name itself and match the variants of query words against both:
+// "privet", "ghbdtn" and "привет" all find a post named "Привет".
+//
+// Folding transliterates Russian and Ukrainian words to Latin letters and
+// then merges the spellings people commonly use interchangeably, such as
+// "kh" and "h", "ts" and "c", "y", "j" and "i", or doubled letters. Folded
+// forms are only compared with each other and never shown.
+package translit
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// russian and ukrainian transliterate the letters of each language.
+// Ukrainian words are told apart by the letters only Ukrainian uses.
+var (
+	russian = map[rune]string{
+		'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+		'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+		'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+		'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+		'я': "ya",
+	}
+	ukrainian = map[rune]string{
+		'а': "a", 'б': "b", 'в': "v", 'г': "h", 'ґ': "g", 'д': "d", 'е': "e", 'є': "ye",
+		'ж': "zh", 'з': "z", 'и': "y", 'і': "i", 'ї': "yi", 'й': "y", 'к': "k", 'л': "l",
+		'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+		'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ь': "", 'ю': "yu",
+		'я': "ya",
+	}
+)
+
+// spellings merges Latin spellings of the same sounds. Longer spellings come
+// first, so that they are replaced before their parts.
+var spellings = strings.NewReplacer(
+	"shch", "sh", "sch", "sh",
+	"kh", "h", "ph", "f", "ts", "c", "tz", "c",
+	"ye", "e", "je", "e", "yo", "e", "jo", "e",
+	"x", "ks", "w", "v", "j", "i", "y", "i",
+)
+
+// minRetypeLength is the length, in characters, below which words of a query
+// are not matched as typed with another keyboard layout: the shorter a word,
+// the more likely it means something in every layout.
+const minRetypeLength = 3
+
+// apostrophes separate syllables in Ukrainian words, as in "м'ята", and are
+// dropped between letters.
+const apostrophes = "'’ʼ"
+
+// Fold returns the folded form of a text: its words lowercased, transliterated
+// to Latin letters and spelled in a single way. Other characters are kept,
+// so words stay apart.
+func Fold(text string) string {
+	var sb strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			sb.WriteRune(unicode.ToLower(runes[i]))
+			i++
+			continue
+		}
+
+		// A word continues across apostrophes followed by a letter
+		end := i
+		for end < len(runes) && (isWordRune(runes[end]) ||
+			strings.ContainsRune(apostrophes, runes[end]) && end+1 < len(runes) && isWordRune(runes[end+1])) {
+			end++
+		}
+		sb.WriteString(foldWord(string(runes[i:end])))
+		i = end
+	}
+	return sb.String()
+}
+
+// foldWord folds a single word.
+func foldWord(word string) string {
+	word = strings.ToLower(word)
+	letters := russian
+	if strings.ContainsAny(word, "іїєґ") {
+		letters = ukrainian
+	}
+
+	var sb strings.Builder
+	for _, r := range word {
+		if latin, ok := letters[r]; ok {
+			sb.WriteString(latin)
+		} else if !strings.ContainsRune(apostrophes, r) {
+			sb.WriteRune(r)
+		}
+	}
+	return squeeze(spellings.Replace(sb.String()))
+}
+
+// squeeze replaces runs of the same letter with a single letter.
+func squeeze(word string) string {
+	var sb strings.Builder
+	var last rune
+	for _, r := range word {
+		if r != last {
+			sb.WriteRune(r)
+		}
+		last = r
+	}
+	return sb.String()
+}
+
+// isWordRune reports whether r is part of a word.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// Query splits a search query into words at whitespace and returns the
+// variants of each word, see Variants.
+func Query(query string) [][]string {
+	words := strings.Fields(query)
+	variants := make([][]string, len(words))
+	for i, word := range words {
+		variants[i] = Variants(word)
+	}
+	return variants
+}
+
+// Variants returns the distinct spellings a word of a query is matched with:
+// the word itself, then its folded form and, for words of at least
+// minRetypeLength characters, the folded forms of the words typed with the
+// same keys on the Russian, Ukrainian and English keyboard layouts, so that
+// "ghbdtn" is also matched as "привет" and "зкщпкфь" as "program".
+func Variants(word string) []string {
+	variants := []string{word}
+	seen := map[string]bool{word: true}
+	add := func(typed string) {
+		if folded := Fold(typed); !seen[folded] {
+			seen[folded] = true
+			variants = append(variants, folded)
+		}
+	}
+
+	add(word)
+	if utf8.RuneCountInString(word) < minRetypeLength {
+		return variants
+	}
+	for _, keys := range []map[rune]rune{toRussian, toUkrainian, toEnglish} {
+		if typed, ok := retype(word, keys); ok {
+			add(typed)
+		}
+	}
+	return variants
+}
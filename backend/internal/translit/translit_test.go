@@ -0,0 +1,150 @@
+package translit
+
+import (
+	"slices"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		// Cyrillic to Latin
+		{"Привет", "privet"},
+		{"Ёлка", "elka"},
+		{"Хабр", "habr"},
+		{"Щука", "shuka"},
+		{"Цой", "coi"},
+		{"Київ", "kiv"},
+		{"Ґанок", "ganok"},
+		{"м'ята", "miata"},
+
+		// Latin spellings of the same sounds
+		{"privet", "privet"},
+		{"Tsoi", "coi"},
+		{"Kyiv", "kiv"},
+		{"Khabr", "habr"},
+		{"Anna", "ana"},
+		{"Philosophy", "filosofi"},
+
+		// Other characters are kept
+		{"Hello, Мир!", "helo, mir!"},
+		{"2024 год", "2024 god"},
+		{"rock'n'roll", "rocknrol"},
+		{"'мир'", "'mir'"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := Fold(tt.text); got != tt.want {
+				t.Errorf("Fold(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVariants(t *testing.T) {
+	tests := []struct {
+		name string
+		word string
+		want []string
+	}{
+		{"Latin word", "privet", []string{"privet", "zkshmue"}},
+		{"Cyrillic word", "Привет", []string{"Привет", "privet", "ghbdtn"}},
+		{"English typed with the Russian layout", "ghbdtn", []string{"ghbdtn", "privet"}},
+		{"Russian typed with the English layout", "зкщпкфь", []string{"зкщпкфь", "zkshpkf", "program"}},
+		{"Ukrainian typed with the English layout", "rb]d", []string{"rb]d", "kiv"}},
+		{"Ukrainian letter typed with the English layout", "cskm", []string{"cskm", "sil"}},
+		{"digits are typed alike", "ghbdtn2", []string{"ghbdtn2", "privet2"}},
+		{"short word is not retyped", "go", []string{"go"}},
+		{"short Cyrillic word", "Го", []string{"Го", "go"}},
+		{"characters without a key", "c++", []string{"c++"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Variants(tt.word); !slices.Equal(got, tt.want) {
+				t.Errorf("Variants(%q) = %q, want %q", tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuery(t *testing.T) {
+	got := Query("  ghbdtn  Go ")
+	want := [][]string{{"ghbdtn", "privet"}, {"Go", "go"}}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("Query = %q, want %q", got, want)
+	}
+
+	if got := Query(" "); len(got) != 0 {
+		t.Errorf("Query of a blank query = %q, want no words", got)
+	}
+}
+
+func TestLayouts(t *testing.T) {
+	n := utf8.RuneCountInString(englishKeys)
+	for name, keys := range map[string]string{"Russian": russianKeys, "Ukrainian": ukrainianKeys} {
+		if got := utf8.RuneCountInString(keys); got != n {
+			t.Errorf("%s layout has %d keys, want %d", name, got, n)
+		}
+	}
+
+	tests := []struct {
+		name string
+		keys map[rune]rune
+		from rune
+		want rune
+	}{
+		{"English to Russian", toRussian, 'q', 'й'},
+		{"English to Russian with Shift", toRussian, '{', 'Х'},
+		{"English to Russian punctuation", toRussian, '/', '.'},
+		{"English to Ukrainian", toUkrainian, 's', 'і'},
+		{"English to Ukrainian with Shift", toUkrainian, '}', 'Ї'},
+		{"Russian to English", toEnglish, 'ы', 's'},
+		{"Russian to English with Shift", toEnglish, 'Ё', '~'},
+		{"Ukrainian to English", toEnglish, 'і', 's'},
+		{"Ukrainian to English with Shift", toEnglish, 'Є', '"'},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, ok := tt.keys[tt.from]; !ok || got != tt.want {
+				t.Errorf("key %q = %q, want %q", tt.from, got, tt.want)
+			}
+		})
+	}
+
+	// Retyping with the other layout and back restores every key
+	for _, keys := range []map[rune]rune{toRussian, toUkrainian} {
+		for _, r := range englishKeys {
+			if back := toEnglish[keys[r]]; back != r {
+				t.Errorf("key %q is retyped back as %q", r, back)
+			}
+		}
+	}
+}
+
+func TestRetype(t *testing.T) {
+	tests := []struct {
+		word   string
+		keys   map[rune]rune
+		want   string
+		wantOK bool
+	}{
+		{"ghbdtn", toRussian, "привет", true},
+		{"Ghbdtn1", toRussian, "Привет1", true},
+		{"привет", toEnglish, "ghbdtn", true},
+		{"gh!", toRussian, "", false},
+		{"привет", toRussian, "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := retype(tt.word, tt.keys)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("retype(%q) = %q, %v, want %q, %v", tt.word, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// Package writer provides the last stage of the ingestion pipeline, which
+// persists processed messages to a storage.Store, mirroring their attachments,
+// adding saved posts to the search index and recording messages that cannot
+// be saved as dead letters.
+package writer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/logging"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/metrics"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/mirror"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/queue"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/search"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/supervisor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of persisted messages.
+var tracer = otel.Tracer("github.com/kirinyoku/kirinyoku-space-web/backend/internal/writer")
+
+// Writer saves processed messages taken from a durable queue to a store.
+type Writer struct {
+	store      storage.Store                            // Destination of processed messages
+	input      *queue.Queue[processor.ProcessedMessage] // Queue of processed messages to save
+	mirror     *mirror.Mirror                           // Optional mirror for attached files
+	deadLetter deadletter.Sink                          // Optional store for messages that could not be saved
+	index      *search.Index                            // Optional search index of saved posts
+	drain      context.CancelFunc                       // Ends the loop once the input queue is empty
+	abort      context.CancelFunc                       // Ends the loop without waiting for retries
+	stopped    chan struct{}                            // Closed when the loop has ended
+}
+
+// Retry policy for saving queued messages. These are variables so that tests
+// can shorten the delays.
+var (
+	maxSaveAttempts   = 5                // Failed attempts before a message is recorded as a dead letter
+	saveRetryDelay    = time.Second      // Delay before the first retry
+	maxSaveRetryDelay = 30 * time.Second // Upper bound of the doubling retry delay
+)
+
+// New creates a Writer that saves the messages of the input queue to store.
+// Returns an error if either dependency is nil.
+func New(store storage.Store, input *queue.Queue[processor.ProcessedMessage]) (*Writer, error) {
+	if store == nil || input == nil {
+		return nil, fmt.Errorf("store and input queue cannot be nil")
+	}
+
+	return &Writer{
+		store: store,
+		input: input,
+	}, nil
+}
+
+// SetMirror enables copying attached files into blob storage before
+// messages are saved. It must be called before Start.
+func (w *Writer) SetMirror(m *mirror.Mirror) {
+	w.mirror = m
+}
+
+// SetDeadLetters sets the store for messages that repeatedly fail to be saved.
+// Entries of messages that are later saved successfully are resolved.
+// It must be called before Start.
+func (w *Writer) SetDeadLetters(sink deadletter.Sink) {
+	w.deadLetter = sink
+}
+
+// SetIndex keeps a search index up to date with the saved posts.
+// It must be called before Start.
+func (w *Writer) SetIndex(index *search.Index) {
+	w.index = index
+}
+
+// Start begins the message processing loop in a separate goroutine,
+// supervised by the given component, which restarts the loop if it fails
+// and records the time of every saved message.
+// The loop continuously takes messages from the input queue and persists each one
+// to the store, mirroring attached files first if a mirror is set.
+// A message is acknowledged only once it is saved or recorded as a dead
+// letter, so messages still in flight are saved again when the loop or the
+// service restarts.
+// Mirror errors are logged but don't interrupt processing; a message whose
+// attachment could not be mirrored is still saved, keeping the blob key of a
+// copy mirrored when the same file was saved before. The loop runs until Stop
+// is called or the input queue is closed.
+func (w *Writer) Start(component *supervisor.Component) {
+	draining, drain := context.WithCancel(context.Background())
+	aborting, abort := context.WithCancel(context.Background())
+	w.drain, w.abort = drain, abort
+	w.stopped = make(chan struct{})
+
+	go func() {
+		defer close(w.stopped)
+		component.Run(aborting, func() error {
+			return w.run(draining, aborting, component)
+		})
+	}()
+
+	slog.Info("Writer started, listening for processed messages")
+}
+
+// run is the processing loop. It starts with the oldest unacknowledged
+// message and returns nil once draining is done and the input queue is
+// empty, when the input queue is closed, or when aborted, and an error if
+// the input queue cannot be written.
+func (w *Writer) run(draining, aborting context.Context, component *supervisor.Component) error {
+	// Deliver again the messages left unacknowledged by a failed run
+	w.input.Rewind()
+
+	for {
+		// Once draining, Get only fails when no queued message is left
+		item, err := w.input.Get(draining)
+		if errors.Is(err, queue.ErrClosed) || errors.Is(err, context.Canceled) {
+			return nil
+		}
+		if err != nil {
+			slog.Error("Failed to take message from queue", "error", err)
+			continue
+		}
+
+		message := item.Value
+		ctx := logging.WithCorrelationID(tracing.Extract(aborting, message.Source.TraceContext), message.Source.CorrelationID)
+		ctx, span := tracer.Start(ctx, "writer.persist", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(
+			attribute.Int64("telegram.chat_id", message.ChatID),
+			attribute.Int("telegram.message_id", message.MessageID),
+		))
+		if w.mirror != nil {
+			if err := w.mirror.Mirror(ctx, &message); err != nil {
+				slog.WarnContext(ctx, "Failed to mirror attachment", "chat_id", message.ChatID, "message_id", message.MessageID, "error", err)
+				w.keepBlobKey(ctx, &message)
+			}
+		}
+
+		stored := w.save(ctx, message)
+		span.End()
+		if !stored {
+			// Only aborting stops save, so leave the message unacknowledged
+			// for the next start of the service
+			return nil
+		}
+
+		if err := w.input.Ack(item.Seq); err != nil {
+			return fmt.Errorf("failed to acknowledge message %d: %w", message.MessageID, err)
+		}
+		component.Beat()
+	}
+}
+
+// keepBlobKey copies the blob key of the stored post onto the attachment of
+// message if the post was saved before with the same file, so that a failed
+// mirror attempt for an edited or replayed post does not erase the key of
+// the copy mirrored earlier. Lookup errors are logged.
+func (w *Writer) keepBlobKey(ctx context.Context, message *processor.ProcessedMessage) {
+	attachment := message.Attachment
+	if attachment == nil || attachment.BlobKey != "" {
+		return
+	}
+
+	stored, err := w.store.GetPost(ctx, message.ChatID, message.MessageID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to look up mirrored attachment", "chat_id", message.ChatID, "message_id", message.MessageID, "error", err)
+		return
+	}
+
+	if stored.Attachment != nil && stored.Attachment.FileUniqueID == attachment.FileUniqueID {
+		attachment.BlobKey = stored.Attachment.BlobKey
+	}
+}
+
+// save stores a message, retrying failed attempts with a growing delay so
+// that a slow or unavailable database holds up the pipeline instead of losing
+// messages. After maxSaveAttempts failures the message is recorded as a dead
+// letter, if a store is set; it is retried until either succeeds or ctx is done.
+// A successfully saved message is added to the search index, if one is set,
+// and its dead-letter entry is removed.
+// Returns false if ctx is done before the message is saved or recorded.
+func (w *Writer) save(ctx context.Context, message processor.ProcessedMessage) bool {
+	delay := saveRetryDelay
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		err := w.store.SaveMessage(ctx, message)
+		if err == nil {
+			metrics.DBWriteDuration.WithLabelValues("success").Observe(time.Since(start).Seconds())
+			break
+		}
+		metrics.DBWriteDuration.WithLabelValues("error").Observe(time.Since(start).Seconds())
+		metrics.DBWriteFailures.Inc()
+
+		slog.WarnContext(ctx, "Failed to save message", "chat_id", message.ChatID, "message_id", message.MessageID, "attempt", attempt, "error", err)
+		if attempt >= maxSaveAttempts && w.deadLetter != nil {
+			recordErr := w.deadLetter.Record(ctx, message.Source, deadletter.StageSave, err)
+			if recordErr == nil {
+				return true
+			}
+			slog.ErrorContext(ctx, "Failed to record dead letter", "chat_id", message.ChatID, "message_id", message.MessageID, "error", recordErr)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return false
+		}
+		delay = min(delay*2, maxSaveRetryDelay)
+	}
+
+	slog.InfoContext(ctx, "Saved message",
+		"library", message.Library,
+		"chat_id", message.ChatID,
+		"message_id", message.MessageID,
+		"name", message.Name,
+	)
+
+	if w.index != nil {
+		w.index.Add(message)
+	}
+
+	if w.deadLetter != nil {
+		if err := w.deadLetter.Resolve(ctx, message.ChatID, message.MessageID); err != nil {
+			slog.ErrorContext(ctx, "Failed to resolve dead letter", "chat_id", message.ChatID, "message_id", message.MessageID, "error", err)
+		}
+	}
+
+	return true
+}
+
+// Stop ends the processing loop once every message in the input queue has
+// been saved, waiting until the loop finishes. If ctx is done first, pending
+// retries are abandoned and ctx.Err() is returned; unsaved messages stay in
+// the input queue. It must only be called after Start, and before the store is closed.
+func (w *Writer) Stop(ctx context.Context) error {
+	w.drain()
+
+	select {
+	case <-w.stopped:
+		w.abort()
+		slog.Info("Writer stopped")
+		return nil
+	case <-ctx.Done():
+		w.abort()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,307 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/blob"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/bot"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/deadletter"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/mirror"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/processor"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/queue"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/storage/memory"
+	"github.com/kirinyoku/kirinyoku-space-web/backend/internal/supervisor"
+)
+
+func init() {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// errUnavailable is returned by failingStore while it fails.
+var errUnavailable = errors.New("database unavailable")
+
+// failingStore is a memory store whose first saves fail.
+type failingStore struct {
+	*memory.Store
+	mu       sync.Mutex
+	failures int   // Number of saves that still fail
+	attempts int   // Number of calls of SaveMessage
+	saved    []int // Message IDs of the successful saves in order
+}
+
+func (s *failingStore) SaveMessage(ctx context.Context, message processor.ProcessedMessage) error {
+	s.mu.Lock()
+	s.attempts++
+	failing := s.failures > 0
+	if failing {
+		s.failures--
+	}
+	s.mu.Unlock()
+
+	if failing {
+		return errUnavailable
+	}
+	if err := s.Store.SaveMessage(ctx, message); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = append(s.saved, message.MessageID)
+	return nil
+}
+
+// recorded is a call of fakeSink.Record.
+type recorded struct {
+	msg   bot.Message
+	stage deadletter.Stage
+	err   error
+}
+
+// fakeSink is a deadletter.Sink that remembers its calls.
+type fakeSink struct {
+	mu       sync.Mutex
+	recorded []recorded // Calls of Record in order
+	resolved []string   // Entry IDs passed to Resolve in order
+}
+
+func (s *fakeSink) Record(ctx context.Context, msg bot.Message, stage deadletter.Stage, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recorded = append(s.recorded, recorded{msg, stage, err})
+	return nil
+}
+
+func (s *fakeSink) Resolve(ctx context.Context, chatID int64, messageID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resolved = append(s.resolved, deadletter.EntryID(chatID, messageID))
+	return nil
+}
+
+// shortenRetries makes failed saves retry immediately for the duration of the test.
+func shortenRetries(t *testing.T) {
+	t.Helper()
+	initial, limit := saveRetryDelay, maxSaveRetryDelay
+	saveRetryDelay, maxSaveRetryDelay = time.Millisecond, time.Millisecond
+	t.Cleanup(func() { saveRetryDelay, maxSaveRetryDelay = initial, limit })
+}
+
+// newMessage returns a processed message of the test channel.
+func newMessage(id int) processor.ProcessedMessage {
+	return processor.ProcessedMessage{
+		Library:   "books",
+		Name:      "Learning Go",
+		Type:      "book",
+		Tags:      []string{"go"},
+		URL:       "https://go.dev",
+		ChatID:    -100,
+		MessageID: id,
+		Timestamp: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Source:    bot.Message{ChatID: -100, MessageID: id},
+	}
+}
+
+// openQueue opens the queue of processed messages at path, failing the test
+// on error.
+func openQueue(t *testing.T, path string) *queue.Queue[processor.ProcessedMessage] {
+	t.Helper()
+	q, err := queue.Open[processor.ProcessedMessage](path, 10)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+// runWriter saves the given messages with a writer of store that records
+// dead letters in sink, stopping it once the queue is drained.
+func runWriter(t *testing.T, store *failingStore, sink *fakeSink, messages ...processor.ProcessedMessage) *queue.Queue[processor.ProcessedMessage] {
+	t.Helper()
+	input := openQueue(t, filepath.Join(t.TempDir(), "processed.log"))
+	for _, message := range messages {
+		if err := input.Put(context.Background(), message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w, err := New(store, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetDeadLetters(sink)
+	w.Start(supervisor.New().Add("writer"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	return input
+}
+
+func TestFailedSaveIsDeadLettered(t *testing.T) {
+	shortenRetries(t)
+	store := &failingStore{Store: memory.New(), failures: maxSaveAttempts}
+	sink := &fakeSink{}
+
+	input := runWriter(t, store, sink, newMessage(1))
+
+	if store.attempts != maxSaveAttempts {
+		t.Errorf("SaveMessage was called %d times, want %d", store.attempts, maxSaveAttempts)
+	}
+	if len(sink.recorded) != 1 {
+		t.Fatalf("Record was called %d times, want once", len(sink.recorded))
+	}
+	got := sink.recorded[0]
+	if got.msg.MessageID != 1 || got.stage != deadletter.StageSave || !errors.Is(got.err, errUnavailable) {
+		t.Errorf("Record(message %d, %q, %v), want message 1 at %q with the save error", got.msg.MessageID, got.stage, got.err, deadletter.StageSave)
+	}
+	if len(sink.resolved) != 0 {
+		t.Errorf("Resolve was called for %v, want no calls", sink.resolved)
+	}
+
+	// The dead-lettered message is acknowledged without being saved
+	if n := input.Len(); n != 0 {
+		t.Errorf("input queue has %d messages, want 0", n)
+	}
+	if _, err := store.GetPost(context.Background(), -100, 1); err == nil {
+		t.Error("dead-lettered message was saved")
+	}
+}
+
+func TestRetriedSaveIsResolved(t *testing.T) {
+	shortenRetries(t)
+	store := &failingStore{Store: memory.New(), failures: maxSaveAttempts - 1}
+	sink := &fakeSink{}
+
+	runWriter(t, store, sink, newMessage(1))
+
+	if store.attempts != maxSaveAttempts {
+		t.Errorf("SaveMessage was called %d times, want %d", store.attempts, maxSaveAttempts)
+	}
+	if len(sink.recorded) != 0 {
+		t.Errorf("Record was called %d times, want no calls before the limit", len(sink.recorded))
+	}
+	if want := deadletter.EntryID(-100, 1); len(sink.resolved) != 1 || sink.resolved[0] != want {
+		t.Errorf("Resolve was called for %v, want [%s]", sink.resolved, want)
+	}
+	if _, err := store.GetPost(context.Background(), -100, 1); err != nil {
+		t.Errorf("message was not saved: %v", err)
+	}
+}
+
+func TestStopDrainsQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "processed.log")
+	input := openQueue(t, path)
+	var want []int
+	for id := 1; id <= 10; id++ {
+		if err := input.Put(context.Background(), newMessage(id)); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, id)
+	}
+
+	store := &failingStore{Store: memory.New()}
+	w, err := New(store, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Start(supervisor.New().Add("writer"))
+
+	// Stop is called while the messages are still queued
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	if !slices.Equal(store.saved, want) {
+		t.Errorf("saved messages %v, want each of %v once", store.saved, want)
+	}
+
+	// Every message was acknowledged, so none is saved again after a restart
+	input.Close()
+	input = openQueue(t, path)
+	if n := input.Len(); n != 0 {
+		t.Errorf("reopened queue has %d messages, want 0", n)
+	}
+}
+
+// unavailableFetcher is a mirror.Fetcher whose downloads fail.
+type unavailableFetcher struct{}
+
+func (unavailableFetcher) FetchFile(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("file %s: Telegram unavailable", fileID)
+}
+
+func TestFailedMirrorKeepsBlobKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		fileUniqueID string // File of the edited post
+		want         string // Blob key of the saved post
+	}{
+		{"same file", "file-1", "-100/1/file-1"},
+		{"replaced file", "file-2", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := blob.NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := mirror.New(unavailableFetcher{}, files)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			store := &failingStore{Store: memory.New()}
+			saved := newMessage(1)
+			saved.Attachment = &processor.Attachment{Kind: "document", FileID: "id-1", FileUniqueID: "file-1", BlobKey: "-100/1/file-1"}
+			if err := store.Store.SaveMessage(context.Background(), saved); err != nil {
+				t.Fatal(err)
+			}
+
+			edited := newMessage(1)
+			edited.Name = "Learning Go, 2nd edition"
+			edited.Attachment = &processor.Attachment{Kind: "document", FileID: "id-2", FileUniqueID: tt.fileUniqueID}
+			input := openQueue(t, filepath.Join(t.TempDir(), "processed.log"))
+			if err := input.Put(context.Background(), edited); err != nil {
+				t.Fatal(err)
+			}
+
+			w, err := New(store, input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.SetMirror(m)
+			w.Start(supervisor.New().Add("writer"))
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := w.Stop(ctx); err != nil {
+				t.Fatalf("Stop: %v", err)
+			}
+
+			got, err := store.GetPost(context.Background(), -100, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != edited.Name {
+				t.Errorf("Name = %q, want the edited %q", got.Name, edited.Name)
+			}
+			if got.Attachment == nil || got.Attachment.BlobKey != tt.want {
+				t.Errorf("Attachment = %+v, want blob key %q", got.Attachment, tt.want)
+			}
+		})
+	}
+}
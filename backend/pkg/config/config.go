@@ -3,20 +3,45 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
+// DefaultLibrary is the library assigned to the channel configured with
+// TELEGRAM_CHAT_ID when no TELEGRAM_CHANNELS mapping is given.
+const DefaultLibrary = "default"
+
+// DefaultDeadLetterCollection is the MongoDB collection holding failed
+// messages when MONGO_DEAD_LETTER_COLLECTION is not set.
+const DefaultDeadLetterCollection = "dead_letters"
+
+// DefaultQueueDir is the directory holding the pipeline's queue logs when
+// QUEUE_DIR is not set.
+const DefaultQueueDir = "data/queue"
+
 // Config holds all configuration parameters for the application.
 type Config struct {
-	TelegramToken   string
-	TelegramChatID  int64
-	MongoURI        string
-	MongoDatabase   string
-	MongoCollection string
-	APIPort         string
+	TelegramToken             string
+	TelegramChannels          map[int64]string // Monitored channel IDs mapped to library identifiers
+	TelegramAdminChatID       int64            // Chat receiving reports about rejected posts; reports are disabled when 0
+	TelegramAPIURL            string           // Base URL of the Bot API server, e.g. a local stand-in
+	TelegramWebhookURL        string           // Public webhook URL; long polling is used when empty
+	TelegramWebhookSecret     string           // Secret token Telegram sends with webhook requests
+	StorageDSN                string           // Post store: a MongoDB URI, sqlite://path/to/posts.db or memory://; defaults to MongoURI
+	MongoURI                  string
+	MongoDatabase             string
+	MongoCollection           string
+	MongoDeadLetterCollection string // Collection holding messages that failed processing or persistence
+	APIPort                   string
+	APIAdminToken             string // Bearer token for admin endpoints; they are disabled when empty
+	BlobDir                   string // Directory for mirrored attachments; mirroring is disabled when empty
+	QueueDir                  string // Directory for the durable queues between pipeline stages
+	LogLevel                  string // Minimum level of logged records: "debug", "info", "warn" or "error"
+	OTLPEndpoint              string // OTLP/HTTP endpoint receiving traces, e.g. http://localhost:4318; tracing is disabled when empty
 }
 
 // Load reads configuration from environment variables and returns a Config struct.
@@ -26,19 +51,54 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("error loading .env file: %w", err)
 	}
 
+	channels, err := parseChannels(os.Getenv("TELEGRAM_CHANNELS"))
+	if err != nil {
+		return nil, fmt.Errorf("TELEGRAM_CHANNELS: %w", err)
+	}
+
 	cfg := &Config{
-		TelegramToken:   os.Getenv("TELEGRAM_TOKEN"),
-		TelegramChatID:  parseChatID(os.Getenv("TELEGRAM_CHAT_ID")),
-		MongoURI:        os.Getenv("MONGO_URI"),
-		MongoDatabase:   os.Getenv("MONGO_DATABASE"),
-		MongoCollection: os.Getenv("MONGO_COLLECTION"),
-		APIPort:         os.Getenv("API_PORT"),
+		TelegramToken:             os.Getenv("TELEGRAM_TOKEN"),
+		TelegramChannels:          channels,
+		TelegramAdminChatID:       parseChatID(os.Getenv("TELEGRAM_ADMIN_CHAT_ID")),
+		TelegramAPIURL:            os.Getenv("TELEGRAM_API_URL"),
+		TelegramWebhookURL:        os.Getenv("TELEGRAM_WEBHOOK_URL"),
+		TelegramWebhookSecret:     os.Getenv("TELEGRAM_WEBHOOK_SECRET"),
+		StorageDSN:                os.Getenv("STORAGE_DSN"),
+		MongoURI:                  os.Getenv("MONGO_URI"),
+		MongoDatabase:             os.Getenv("MONGO_DATABASE"),
+		MongoCollection:           os.Getenv("MONGO_COLLECTION"),
+		MongoDeadLetterCollection: os.Getenv("MONGO_DEAD_LETTER_COLLECTION"),
+		APIPort:                   os.Getenv("API_PORT"),
+		APIAdminToken:             os.Getenv("API_ADMIN_TOKEN"),
+		BlobDir:                   os.Getenv("BLOB_DIR"),
+		QueueDir:                  os.Getenv("QUEUE_DIR"),
+		LogLevel:                  os.Getenv("LOG_LEVEL"),
+		OTLPEndpoint:              os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
 	}
 
 	if cfg.APIPort == "" {
 		cfg.APIPort = ":8080"
 	}
 
+	if cfg.QueueDir == "" {
+		cfg.QueueDir = DefaultQueueDir
+	}
+
+	if cfg.StorageDSN == "" {
+		cfg.StorageDSN = cfg.MongoURI
+	}
+
+	if cfg.MongoDeadLetterCollection == "" {
+		cfg.MongoDeadLetterCollection = DefaultDeadLetterCollection
+	}
+
+	// Fall back to the single-channel setup
+	if os.Getenv("TELEGRAM_CHANNELS") == "" {
+		if chatID := parseChatID(os.Getenv("TELEGRAM_CHAT_ID")); chatID != 0 {
+			cfg.TelegramChannels = map[int64]string{chatID: DefaultLibrary}
+		}
+	}
+
 	if err := cfg.validate(); err != nil {
 		return nil, err
 	}
@@ -61,6 +121,57 @@ func parseChatID(chatIDStr string) int64 {
 	return chatID
 }
 
+// parseChannels converts a comma-separated list of "chatID=library" pairs
+// into a map of channel IDs to library identifiers.
+// Returns nil if the input is empty, and an error naming the first pair
+// without a valid chat ID or library.
+func parseChannels(channelsStr string) (map[int64]string, error) {
+	if channelsStr == "" {
+		return nil, nil
+	}
+
+	channels := make(map[int64]string)
+	for _, pair := range strings.Split(channelsStr, ",") {
+		chatIDStr, library, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid channel mapping %q", pair)
+		}
+
+		chatID := parseChatID(strings.TrimSpace(chatIDStr))
+		library = strings.TrimSpace(library)
+		if chatID == 0 || library == "" {
+			return nil, fmt.Errorf("invalid channel mapping %q", pair)
+		}
+
+		channels[chatID] = library
+	}
+
+	return channels, nil
+}
+
+// Library returns the library identifier of a monitored channel.
+// The second result is false if the channel is not configured.
+func (c *Config) Library(chatID int64) (string, bool) {
+	library, ok := c.TelegramChannels[chatID]
+	return library, ok
+}
+
+// UseWebhook reports whether the bot should receive updates via webhook
+// instead of long polling.
+func (c *Config) UseWebhook() bool {
+	return c.TelegramWebhookURL != ""
+}
+
+// WebhookPath returns the path component of the webhook URL,
+// which is the route the API server must accept updates on.
+func (c *Config) WebhookPath() string {
+	u, err := url.Parse(c.TelegramWebhookURL)
+	if err != nil || u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
+
 // validate checks if all required configuration fields are properly set.
 // Returns an error if any required field is missing or invalid.
 func (c *Config) validate() error {
@@ -68,21 +179,56 @@ func (c *Config) validate() error {
 		return fmt.Errorf("TELEGRAM_TOKEN is required")
 	}
 
-	if c.TelegramChatID == 0 {
-		return fmt.Errorf("TELEGRAM_CHAT_ID is required and must be a valid integer")
+	if len(c.TelegramChannels) == 0 {
+		return fmt.Errorf("TELEGRAM_CHANNELS (chatID=library pairs separated by commas) or TELEGRAM_CHAT_ID is required and must be valid")
 	}
 
-	if c.MongoURI == "" {
-		return fmt.Errorf("MONGO_URI is required")
+	if c.UseWebhook() {
+		u, err := url.Parse(c.TelegramWebhookURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("TELEGRAM_WEBHOOK_URL must be a valid https URL")
+		}
+
+		if !validSecretToken(c.TelegramWebhookSecret) {
+			return fmt.Errorf("TELEGRAM_WEBHOOK_SECRET is required in webhook mode and must be 1-256 characters of A-Z, a-z, 0-9, _ and -")
+		}
 	}
 
-	if c.MongoDatabase == "" {
-		return fmt.Errorf("MONGO_DATABASE is required")
+	if c.StorageDSN == "" {
+		return fmt.Errorf("STORAGE_DSN or MONGO_URI is required")
 	}
 
-	if c.MongoCollection == "" {
-		return fmt.Errorf("MONGO_COLLECTION is required")
+	if c.UseMongo() {
+		if c.MongoDatabase == "" {
+			return fmt.Errorf("MONGO_DATABASE is required")
+		}
+
+		if c.MongoCollection == "" {
+			return fmt.Errorf("MONGO_COLLECTION is required")
+		}
 	}
 
 	return nil
 }
+
+// UseMongo reports whether posts are stored in MongoDB rather than in
+// another backend selected by the storage DSN.
+func (c *Config) UseMongo() bool {
+	return strings.HasPrefix(c.StorageDSN, "mongodb://") || strings.HasPrefix(c.StorageDSN, "mongodb+srv://")
+}
+
+// validSecretToken checks the webhook secret against the character set
+// and length accepted by Telegram.
+func validSecretToken(token string) bool {
+	if len(token) == 0 || len(token) > 256 {
+		return false
+	}
+
+	for _, r := range token {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+
+	return true
+}
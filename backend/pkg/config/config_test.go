@@ -0,0 +1,35 @@
+package config
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseChannels(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[int64]string
+		wantErr bool
+	}{
+		{"valid", "-1001=books,-1002=papers", map[int64]string{-1001: "books", -1002: "papers"}, false},
+		{"spaces around entries", " -1001 = books , -1002=papers ", map[int64]string{-1001: "books", -1002: "papers"}, false},
+		{"empty", "", nil, false},
+		{"missing =", "-1001=books,-1002", nil, true},
+		{"unparsable ID", "channel=books", nil, true},
+		{"empty library", "-1001= ", nil, true},
+		{"trailing comma", "-1001=books,", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseChannels(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseChannels(%q) error = %v, want error %v", tt.input, err, tt.wantErr)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("parseChannels(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
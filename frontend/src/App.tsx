@@ -1,16 +1,20 @@
 import { useEffect, useState } from "react";
-import {
-  fetchLanguages,
-  fetchPostsWithFilters,
-  fetchTags,
-  Post,
-} from "./api/api";
+import { FacetCount, Facets, fetchPostsWithFilters, Post } from "./api/api";
 import Sidebar from "./components/sidebar/Sidebar";
 import Navbar from "./components/navbar/Navbar";
 import Pagination from "./components/post/Pagination";
 import PostListing from "./components/post/PostListing";
 import SearchBar from "./components/search/SearchBar";
 
+// Keeps the selected filter value listed even when no post matches it.
+const withSelected = (
+  counts: FacetCount[],
+  selected: string | null
+): FacetCount[] =>
+  selected && !counts.some((count) => count.value === selected)
+    ? [...counts, { value: selected, count: 0 }]
+    : counts;
+
 const App: React.FC = () => {
   const [selectedTag, setSelectedTag] = useState<string | null>(null);
   const [selectedType, setSelectedType] = useState<string | null>(null);
@@ -18,26 +22,15 @@ const App: React.FC = () => {
   const [searchQuery, setSearchQuery] = useState<string>("");
   const [currentPage, setCurrentPage] = useState<number>(1);
   const [posts, setPosts] = useState<Post[]>([]);
-  const [tags, setTags] = useState<string[]>([]);
-  const [languages, setLanguages] = useState<string[]>([]);
+  const [facets, setFacets] = useState<Facets>({
+    type: [],
+    tags: [],
+    language: [],
+  });
   const [totalPages, setTotalPages] = useState<number>(1);
   const [loading, setLoading] = useState<boolean>(false);
   const limit = 15;
 
-  useEffect(() => {
-    const loadInitialData = async () => {
-      try {
-        const fetchedTags = await fetchTags();
-        setTags(fetchedTags);
-        const fetchedLanguages = await fetchLanguages();
-        setLanguages(fetchedLanguages);
-      } catch (error) {
-        console.error("Failed to fetch initial data:", error);
-      }
-    };
-    loadInitialData();
-  }, []);
-
   useEffect(() => {
     const loadPosts = async () => {
       setLoading(true);
@@ -48,9 +41,14 @@ const App: React.FC = () => {
           selectedType,
           selectedLanguage,
           currentPage,
-          limit
+          limit,
+          null,
+          true
         );
         setPosts(response.posts);
+        if (response.facets) {
+          setFacets(response.facets);
+        }
         const calculatedTotalPages = Math.max(
           1,
           Math.ceil(response.total_count / limit)
@@ -70,20 +68,18 @@ const App: React.FC = () => {
     loadPosts();
   }, [searchQuery, selectedTag, selectedType, selectedLanguage, currentPage]);
 
-  const types = ["video", "article", "website"];
-
   return (
     <div className="min-h-screen flex flex-col">
       <Navbar />
       <main className="flex-1 flex flex-col md:flex-row">
         <Sidebar
-          tags={tags}
+          tags={withSelected(facets.tags, selectedTag)}
           selectedTag={selectedTag}
           onTagSelect={setSelectedTag}
-          types={types}
+          types={withSelected(facets.type, selectedType)}
           selectedType={selectedType}
           onTypeSelect={setSelectedType}
-          languages={languages}
+          languages={withSelected(facets.language, selectedLanguage)}
           selectedLanguage={selectedLanguage}
           onLanguageSelect={setSelectedLanguage}
         />
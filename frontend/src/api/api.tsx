@@ -1,16 +1,50 @@
 import axios from "axios";
 
+export interface Attachment {
+  kind: string;
+  file_id: string;
+  file_unique_id: string;
+  file_name?: string;
+  mime_type?: string;
+  size?: number;
+  blob_key?: string;
+}
+
+export interface Link {
+  url: string;
+  text: string;
+}
+
 export interface Post {
+  library: string;
   name: string;
   type: string;
+  description?: string;
   tags: string[];
   url: string;
+  links: Link[] | null;
+  chat_id: number;
+  message_id: number;
   timestamp: string;
+  ingested_at: string;
+  attachment?: Attachment;
+}
+
+export interface FacetCount {
+  value: string;
+  count: number;
+}
+
+export interface Facets {
+  type: FacetCount[];
+  tags: FacetCount[];
+  language: FacetCount[];
 }
 
 interface PostsResponse {
   posts: Post[];
   total_count: number;
+  facets?: Facets;
 }
 
 const BASE_URL = import.meta.env.VITE_BASE_URL;
@@ -25,6 +59,18 @@ const normalizeResponse = (data: any): PostsResponse => {
   return {
     posts: Array.isArray(data.posts) ? data.posts : [],
     total_count: typeof data.total_count === "number" ? data.total_count : 0,
+    facets: normalizeFacets(data.facets),
+  };
+};
+
+const normalizeFacets = (data: any): Facets | undefined => {
+  if (!data || typeof data !== "object") {
+    return undefined;
+  }
+  return {
+    type: Array.isArray(data.type) ? data.type : [],
+    tags: Array.isArray(data.tags) ? data.tags : [],
+    language: Array.isArray(data.language) ? data.language : [],
   };
 };
 
@@ -34,13 +80,17 @@ export const fetchPostsWithFilters = async (
   type: string | null,
   language: string | null,
   page: number,
-  limit: number
+  limit: number,
+  library: string | null = null,
+  facets: boolean = false
 ): Promise<PostsResponse> => {
   const params: any = { page, limit };
   if (query) params.search = query;
   if (tag) params.tag = tag;
   if (type) params.type = type;
   if (language) params.language = language;
+  if (library) params.library = library;
+  if (facets) params.facets = true;
 
   const response = await api.get("/posts", { params });
   return normalizeResponse(response.data);
@@ -81,12 +131,30 @@ export const fetchPostsByLanguage = async (
   return normalizeResponse(response.data);
 };
 
-export const fetchTags = async (): Promise<string[]> => {
-  const response = await api.get("/tags");
+export const getPostFileURL = (post: Post): string | null =>
+  post.attachment?.blob_key
+    ? `${BASE_URL}/posts/${post.chat_id}/${post.message_id}/file`
+    : null;
+
+export const fetchTags = async (
+  library: string | null = null
+): Promise<string[]> => {
+  const response = await api.get("/tags", {
+    params: library ? { library } : {},
+  });
+  return Array.isArray(response.data) ? response.data : [];
+};
+
+export const fetchLanguages = async (
+  library: string | null = null
+): Promise<string[]> => {
+  const response = await api.get("/languages", {
+    params: library ? { library } : {},
+  });
   return Array.isArray(response.data) ? response.data : [];
 };
 
-export const fetchLanguages = async (): Promise<string[]> => {
-  const response = await api.get("/languages");
+export const fetchLibraries = async (): Promise<string[]> => {
+  const response = await api.get("/libraries");
   return Array.isArray(response.data) ? response.data : [];
 };
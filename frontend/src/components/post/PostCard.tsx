@@ -17,6 +17,11 @@ const PostCard: React.FC<PostCardProps> = ({ post }) => {
       onClick={handleCardClick}
     >
       <h3 className="text-lg font-semibold text-gray-900 mb-2">{post.name}</h3>
+      {post.description && (
+        <p className="text-sm text-gray-600 mb-2 line-clamp-2">
+          {post.description}
+        </p>
+      )}
       <div className="flex justify-between items-center">
         <div className="flex flex-wrap gap-2">
           {tags.map((tag) => (
@@ -1,5 +1,7 @@
+import { FacetCount } from "../../api/api";
+
 interface HashtagsProps {
-  tags: string[];
+  tags: FacetCount[];
   selectedTag: string | null;
   onTagSelect: (tag: string | null) => void;
 }
@@ -18,7 +20,7 @@ const HashtagsFilter: React.FC<HashtagsProps> = ({
       <h3 className="text-md font-medium text-gray-800 mb-2">Hashtags</h3>
       <ul className="flex flex-wrap gap-x-2 space-y-1">
         {/* List of tags */}
-        {tags.map((tag) => (
+        {tags.map(({ value: tag, count }) => (
           <li key={tag}>
             <button
               className={`w-full text-left rounded text-sm bg-transparent cursor-pointer ${
@@ -28,7 +30,7 @@ const HashtagsFilter: React.FC<HashtagsProps> = ({
               }`}
               onClick={() => handleTagClick(tag)}
             >
-              #{tag}
+              #{tag} <span className="text-xs text-gray-300">{count}</span>
             </button>
           </li>
         ))}
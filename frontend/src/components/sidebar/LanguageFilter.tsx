@@ -1,5 +1,7 @@
+import { FacetCount } from "../../api/api";
+
 interface LanguageFilterProps {
-  languages: string[];
+  languages: FacetCount[];
   selectedLanguage: string | null;
   onLanguageSelect: (language: string | null) => void;
 }
@@ -17,7 +19,7 @@ const LanguageFilter: React.FC<LanguageFilterProps> = ({
     <div>
       <h3 className="text-md font-medium text-gray-800 mb-2">Language</h3>
       <ul className="flex flex-wrap gap-x-2 space-y-1">
-        {languages.map((language) => (
+        {languages.map(({ value: language, count }) => (
           <li key={language}>
             <button
               className={`px-4 py-1 bg-gray-100 rounded-md text-sm cursor-pointer ${
@@ -27,7 +29,7 @@ const LanguageFilter: React.FC<LanguageFilterProps> = ({
               }`}
               onClick={() => handleLanguageClick(language)}
             >
-              {language}
+              {language} <span className="text-xs text-gray-300">{count}</span>
             </button>
           </li>
         ))}
@@ -1,17 +1,18 @@
+import { FacetCount } from "../../api/api";
 import HashtagsFilter from "./HashtagsFilter";
 import LanguageFilter from "./LanguageFilter";
 import TypeFilter from "./TypeFilter";
 
 interface SidebarProps {
-  tags: string[];
+  tags: FacetCount[];
   selectedTag: string | null;
   onTagSelect: (tag: string | null) => void;
 
-  types: string[];
+  types: FacetCount[];
   selectedType: string | null;
   onTypeSelect: (type: string | null) => void;
 
-  languages: string[];
+  languages: FacetCount[];
   selectedLanguage: string | null;
   onLanguageSelect: (language: string | null) => void;
 }
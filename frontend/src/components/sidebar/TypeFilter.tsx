@@ -1,5 +1,7 @@
+import { FacetCount } from "../../api/api";
+
 interface TypeFilterProps {
-  types: string[];
+  types: FacetCount[];
   selectedType: string | null;
   onTypeSelect: (type: string | null) => void;
 }
@@ -17,7 +19,7 @@ const TypeFilter: React.FC<TypeFilterProps> = ({
     <div>
       <h3 className="text-md font-medium text-gray-800 mb-2">Type</h3>
       <ul className="flex flex-wrap gap-x-2 space-y-1">
-        {types.map((type) => (
+        {types.map(({ value: type, count }) => (
           <li key={type}>
             <button
               className={`px-4 py-1 bg-gray-100 rounded-md text-sm cursor-pointer ${
@@ -25,7 +27,8 @@ const TypeFilter: React.FC<TypeFilterProps> = ({
               }`}
               onClick={() => handleTypeClick(type)}
             >
-              {type.charAt(0) + type.slice(1)}
+              {type.charAt(0) + type.slice(1)}{" "}
+              <span className="text-xs text-gray-300">{count}</span>
             </button>
           </li>
         ))}